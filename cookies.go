@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+)
+
+// refreshCookieMaxAge matches the 60 day refresh token expiry.
+const refreshCookieMaxAge = 60 * 24 * time.Hour
+
+// setSessionCookies hands a browser session its tokens as HttpOnly cookies
+// so scripts never see them, plus a fresh CSRF token that scripts can
+// read. The CSRF token is returned for the response body as well. The
+// access and CSRF cookies are SameSite=Lax so the OAuth consent page still
+// sees the session when an app links the user there.
+func setSessionCookies(rw http.ResponseWriter, access auth.AccessToken, refreshToken string) (string, error) {
+	csrfToken, err := auth.MakeCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(rw, &http.Cookie{
+		Name:     auth.AccessTokenCookie,
+		Value:    access.Token,
+		Path:     "/",
+		Expires:  access.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(rw, &http.Cookie{
+		Name:     auth.RefreshTokenCookie,
+		Value:    refreshToken,
+		Path:     "/api",
+		MaxAge:   int(refreshCookieMaxAge / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(rw, &http.Cookie{
+		Name:     auth.CSRFCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		MaxAge:   int(refreshCookieMaxAge / time.Second),
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return csrfToken, nil
+}
+
+func clearSessionCookies(rw http.ResponseWriter) {
+	for name, path := range map[string]string{
+		auth.AccessTokenCookie:  "/",
+		auth.RefreshTokenCookie: "/api",
+		auth.CSRFCookie:         "/",
+	} {
+		http.SetCookie(rw, &http.Cookie{
+			Name:   name,
+			Path:   path,
+			MaxAge: -1,
+			Secure: true,
+		})
+	}
+}
+
+// middlewareCSRF makes state-changing requests that authenticate with
+// session cookies prove they came from our own pages by echoing the CSRF
+// cookie in the X-CSRF-Token header, or the csrf_token field of a form.
+// Requests with an Authorization header can't be forged cross-site and
+// pass through.
+func middlewareCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if auth.UsesSessionCookies(req.Header) {
+				token := req.Header.Get(auth.CSRFHeader)
+				if token == "" {
+					token = req.PostFormValue(auth.CSRFFormField)
+				}
+				if err := auth.CheckCSRF(req.Header, token); err != nil {
+					respondWithError(rw, http.StatusForbidden, err.Error(), err)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	auditLoginSucceeded      = "login.succeeded"
+	auditLoginFailed         = "login.failed"
+	auditReauthFailed        = "reauthentication.failed"
+	auditPasswordChanged     = "password.changed"
+	auditPasswordReset       = "password.reset"
+	auditEmailChanged        = "email.changed"
+	auditTwoFactorEnabled    = "two_factor.enabled"
+	auditTwoFactorDisabled   = "two_factor.disabled"
+	auditSessionRevoked      = "session.revoked"
+	auditAllSessionsRevoked  = "session.revoked_all"
+	auditRefreshTokenReused  = "refresh_token.reused"
+	auditAccessTokenCreated  = "personal_access_token.created"
+	auditAccessTokenRevoked  = "personal_access_token.revoked"
+	auditAppAuthorized       = "oauth.app_authorized"
+	auditAppRevoked          = "oauth.app_revoked"
+	auditAuthCodeReused      = "oauth.code_reused"
+	auditIdentityLinked      = "identity.linked"
+	auditIdentityUnlinked    = "identity.unlinked"
+	auditInvitesCreated      = "invite.created"
+	auditMembershipUpgraded  = "membership.upgraded"
+	auditAdminReset          = "admin.reset"
+	auditAdminRoleChanged    = "admin.role_changed"
+	auditAdminLockoutCleared = "admin.lockout_cleared"
+	auditAdminResourceServer = "admin.resource_server_changed"
+	auditChirpRemoved        = "moderation.chirp_removed"
+)
+
+const (
+	auditEventsLimit         = 100
+	requestIDHeader          = "X-Request-ID"
+	maxClientRequestIDLength = 64
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	actorIDKey
+)
+
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+type AuditEvent struct {
+	ID        uuid.UUID  `json:"id"`
+	Type      string     `json:"type"`
+	ActorID   *uuid.UUID `json:"actor_id"`
+	TargetID  *uuid.UUID `json:"target_id"`
+	IPAddress string     `json:"ip_address"`
+	RequestID string     `json:"request_id"`
+	Details   string     `json:"details"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerGetSecurityEvents(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	events, err := cfg.dbQueries.GetUserAuditEvents(req.Context(), database.GetUserAuditEventsParams{
+		UserID:    userID,
+		MaxEvents: auditEventsLimit,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get security events", err)
+		return
+	}
+
+	// events done to the user by staff, e.g. a role change, don't reveal
+	// who did it or from where
+	for i := range events {
+		if events[i].ActorID.Valid && events[i].ActorID.UUID != userID {
+			events[i].ActorID = uuid.NullUUID{}
+			events[i].IpAddress = ""
+		}
+	}
+
+	respondWithJSON(rw, http.StatusOK, databaseAuditEventsToAuditEvents(events))
+}
+
+// handlerGetAuditEvents lists the newest events first. It can be narrowed
+// with ?type=, ?actor_id= and ?target_id=, and paged with ?before= set to
+// the created_at of the last event seen.
+func (cfg *apiConfig) handlerGetAuditEvents(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	params := database.GetAuditEventsParams{MaxEvents: auditEventsLimit}
+
+	if eventType := query.Get("type"); eventType != "" {
+		params.EventType = sql.NullString{String: eventType, Valid: true}
+	}
+	var err error
+	if params.ActorID, err = parseOptionalUUID(query.Get("actor_id")); err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid actor_id", err)
+		return
+	}
+	if params.TargetID, err = parseOptionalUUID(query.Get("target_id")); err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid target_id", err)
+		return
+	}
+	if v := query.Get("before"); v != "" {
+		before, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			respondWithError(rw, http.StatusBadRequest, "before must be an RFC 3339 timestamp", err)
+			return
+		}
+		params.Before = sql.NullTime{Time: before, Valid: true}
+	}
+
+	events, err := cfg.dbQueries.GetAuditEvents(req.Context(), params)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get audit events", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, databaseAuditEventsToAuditEvents(events))
+}
+
+// recordAuditEvent appends to the audit log. A failure is only logged so
+// that it never takes the audited action down with it. Pass uuid.Nil for
+// an unknown actor or target.
+func (cfg *apiConfig) recordAuditEvent(req *http.Request, eventType string, actorID, targetID uuid.UUID, details string) {
+	err := cfg.dbQueries.CreateAuditEvent(req.Context(), database.CreateAuditEventParams{
+		EventType: eventType,
+		ActorID:   uuid.NullUUID{UUID: actorID, Valid: actorID != uuid.Nil},
+		TargetID:  uuid.NullUUID{UUID: targetID, Valid: targetID != uuid.Nil},
+		IpAddress: clientIP(req),
+		RequestID: requestID(req),
+		Details:   details,
+	})
+	if err != nil {
+		log.Printf("Couldn't record audit event %s: %v", eventType, err)
+	}
+}
+
+// middlewareRequestID tags every request with an ID that is echoed in
+// X-Request-ID and stored with its audit events. A well-formed ID sent by
+// the client, e.g. from a proxy, is kept.
+func middlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(requestIDHeader)
+		if len(id) > maxClientRequestIDLength || !requestIDRegexp.MatchString(id) {
+			id = uuid.NewString()
+		}
+		rw.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), requestIDKey, id)))
+	})
+}
+
+func requestID(req *http.Request) string {
+	id, _ := req.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// requestActorID is the user middlewareRequireRole authenticated, or
+// uuid.Nil outside of role-protected routes.
+func requestActorID(req *http.Request) uuid.UUID {
+	id, _ := req.Context().Value(actorIDKey).(uuid.UUID)
+	return id
+}
+
+func parseOptionalUUID(s string) (uuid.NullUUID, error) {
+	if s == "" {
+		return uuid.NullUUID{}, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	return uuid.NullUUID{UUID: id, Valid: true}, nil
+}
+
+func databaseAuditEventsToAuditEvents(events []database.AuditEvent) []AuditEvent {
+	auditEvents := []AuditEvent{}
+	for _, event := range events {
+		auditEvent := AuditEvent{
+			ID:        event.ID,
+			Type:      event.EventType,
+			IPAddress: event.IpAddress,
+			RequestID: event.RequestID,
+			Details:   event.Details,
+			CreatedAt: event.CreatedAt,
+		}
+		if event.ActorID.Valid {
+			auditEvent.ActorID = &event.ActorID.UUID
+		}
+		if event.TargetID.Valid {
+			auditEvent.TargetID = &event.TargetID.UUID
+		}
+		auditEvents = append(auditEvents, auditEvent)
+	}
+	return auditEvents
+}
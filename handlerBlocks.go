@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Block struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// handlerBlockUser blocks a user. Follows between the two are removed, and
+// neither can follow the other or message them until the block is lifted.
+func (cfg *apiConfig) handlerBlockUser(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	blockedID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	if blockedID == userID {
+		respondWithError(rw, http.StatusBadRequest, "You can't block yourself", nil)
+		return
+	}
+
+	if _, err := cfg.dbQueries.GetUserByID(req.Context(), blockedID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusNotFound, "user not found", err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't block user", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	err = qtx.CreateBlock(req.Context(), database.CreateBlockParams{
+		BlockerID: userID,
+		BlockedID: blockedID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't block user", err)
+		return
+	}
+	err = qtx.DeleteFollowsBetween(req.Context(), database.DeleteFollowsBetweenParams{
+		UserA: userID,
+		UserB: blockedID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't remove follows", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't block user", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerUnblockUser(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	blockedID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	err = cfg.dbQueries.DeleteBlock(req.Context(), database.DeleteBlockParams{
+		BlockerID: userID,
+		BlockedID: blockedID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't unblock user", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerGetBlocks(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersRead)
+	if !ok {
+		return
+	}
+
+	blocks, err := cfg.dbQueries.GetBlocks(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get blocked users", err)
+		return
+	}
+
+	blocksResponse := []Block{}
+	for _, b := range blocks {
+		blocksResponse = append(blocksResponse, Block{
+			UserID:    b.BlockedID,
+			CreatedAt: b.CreatedAt,
+		})
+	}
+
+	respondWithJSON(rw, http.StatusOK, blocksResponse)
+}
+
+// requireNotBlocked responds with a 403 and returns false if either user
+// has blocked the other. It doesn't say which way the block goes.
+func (cfg *apiConfig) requireNotBlocked(rw http.ResponseWriter, req *http.Request, userID, otherID uuid.UUID, msg string) bool {
+	blocked, err := cfg.dbQueries.IsBlockedBetween(req.Context(), database.IsBlockedBetweenParams{
+		UserA: userID,
+		UserB: otherID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check blocks", err)
+		return false
+	}
+	if blocked {
+		respondWithError(rw, http.StatusForbidden, msg, nil)
+		return false
+	}
+	return true
+}
@@ -1,51 +1,206 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid, expired or revoked refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reuse detected")
 )
 
 func (cfg *apiConfig) handlerRefreshToken(rw http.ResponseWriter, req *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token,omitempty"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		CSRFToken    string `json:"csrf_token,omitempty"`
 	}
 
-	refreshToken, err := auth.GetBearerToken(req.Header)
+	refreshToken, err := auth.GetRefreshToken(req.Header)
 	if err != nil {
 		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
 		return
 	}
 
-	user, err := cfg.dbQueries.GetUserFromRefreshToken(req.Context(), refreshToken)
+	// refresh tokens issued to OAuth clients are only good at /api/oauth/token
+	accessToken, newRefreshToken, err := cfg.rotateSession(req, refreshToken, uuid.NullUUID{})
+	if errors.Is(err, errRefreshTokenReused) {
+		respondWithError(rw, http.StatusUnauthorized, "Refresh token reuse detected, please log in again", err)
+		return
+	}
+	if errors.Is(err, errInvalidRefreshToken) {
+		respondWithError(rw, http.StatusUnauthorized, "Refresh token is invalid, expired or revoked", err)
+		return
+	}
 	if err != nil {
-		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't refresh token", err)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(user.ID, cfg.secret, 1*time.Hour)
-	if err != nil {
-		respondWithError(rw, http.StatusInternalServerError, "Could not create jwt token: %v", err)
+	// browser sessions get their new tokens the way they sent the old one
+	if auth.UsesSessionCookies(req.Header) {
+		csrfToken, err := setSessionCookies(rw, accessToken, newRefreshToken)
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Could not create CSRF token", err)
+			return
+		}
+		respondWithJSON(rw, http.StatusOK, response{CSRFToken: csrfToken})
 		return
 	}
 
-	respondWithJSON(rw, http.StatusOK, response{Token: accessToken})
+	respondWithJSON(rw, http.StatusOK, response{
+		Token:        accessToken.Token,
+		RefreshToken: newRefreshToken,
+	})
+}
+
+// rotateSession exchanges a refresh token issued to clientID (none for
+// first-party logins) for a new access token and refresh token. A token
+// that was already rotated is being replayed, most likely by someone who
+// stole it, so its whole family is revoked and both holders have to log
+// in again.
+func (cfg *apiConfig) rotateSession(req *http.Request, refreshToken string, clientID uuid.NullUUID) (auth.AccessToken, string, error) {
+	tokenHash := auth.HashToken(refreshToken)
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		return auth.AccessToken{}, "", err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// the row lock makes a concurrent refresh with the same token wait for
+	// this one and then see it as rotated, so a replay racing the real
+	// client is still caught as reuse
+	stored, err := qtx.GetRefreshTokenForUpdate(req.Context(), tokenHash)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && stored.ClientID != clientID) {
+		return auth.AccessToken{}, "", errInvalidRefreshToken
+	}
+	if err != nil {
+		return auth.AccessToken{}, "", err
+	}
+
+	rotated, err := qtx.RotateRefreshToken(req.Context(), tokenHash)
+	if err != nil {
+		return auth.AccessToken{}, "", err
+	}
+	if rotated == 0 {
+		if stored.RotatedAt.Valid && !stored.RevokedAt.Valid {
+			if err := qtx.RevokeRefreshTokenFamily(req.Context(), stored.FamilyID); err != nil {
+				return auth.AccessToken{}, "", err
+			}
+			if err := cfg.denyFamilyAccessTokens(req.Context(), qtx, stored.FamilyID); err != nil {
+				return auth.AccessToken{}, "", err
+			}
+			if err := tx.Commit(); err != nil {
+				return auth.AccessToken{}, "", err
+			}
+			cfg.recordAuditEvent(req, auditRefreshTokenReused, uuid.Nil, stored.UserID, "session "+stored.FamilyID.String())
+			return auth.AccessToken{}, "", errRefreshTokenReused
+		}
+		return auth.AccessToken{}, "", errInvalidRefreshToken
+	}
+
+	// the role and the app's grant are read fresh so changes apply on refresh
+	user, err := qtx.GetUserByID(req.Context(), stored.UserID)
+	if err != nil {
+		return auth.AccessToken{}, "", err
+	}
+
+	var accessToken auth.AccessToken
+	if clientID.Valid {
+		grant, err := qtx.GetOAuthGrant(req.Context(), database.GetOAuthGrantParams{
+			UserID:   user.ID,
+			ClientID: clientID.UUID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return auth.AccessToken{}, "", errInvalidRefreshToken
+		}
+		if err != nil {
+			return auth.AccessToken{}, "", err
+		}
+		accessToken, err = auth.MakeDelegatedAccessToken(user.ID, clientID.UUID.String(), grant.Scopes, cfg.jwtKeys, oauthAccessTokenExpiry)
+		if err != nil {
+			return auth.AccessToken{}, "", err
+		}
+	} else {
+		accessToken, err = auth.MakeAccessToken(user.ID, auth.Role(user.Role), cfg.jwtKeys, 1*time.Hour)
+		if err != nil {
+			return auth.AccessToken{}, "", err
+		}
+	}
+
+	newRefreshToken, err := createRefreshToken(req, qtx, stored.UserID, stored.FamilyID, clientID, accessToken)
+	if err != nil {
+		return auth.AccessToken{}, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return auth.AccessToken{}, "", err
+	}
+	return accessToken, newRefreshToken, nil
 }
 
 func (cfg *apiConfig) handlerRevokeRefreshToken(rw http.ResponseWriter, req *http.Request) {
-	refreshToken, err := auth.GetBearerToken(req.Header)
+	refreshToken, err := auth.GetRefreshToken(req.Header)
 	if err != nil {
 		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
 		return
 	}
 
-	_, err = cfg.dbQueries.GetRefreshToken(req.Context(), refreshToken)
+	stored, err := cfg.dbQueries.GetRefreshToken(req.Context(), auth.HashToken(refreshToken))
 	if err != nil {
 		respondWithError(rw, http.StatusUnauthorized, "Couldn't find the refresh token", err)
+		return
+	}
+
+	// logging out ends the session, so the rest of the family goes too
+	if err := cfg.dbQueries.RevokeRefreshTokenFamily(req.Context(), stored.FamilyID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke the refresh token", err)
+		return
+	}
+	if err := cfg.denyFamilyAccessTokens(req.Context(), cfg.dbQueries, stored.FamilyID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke the access tokens", err)
+		return
 	}
 
-	cfg.dbQueries.RevokeRefreshToken(req.Context(), refreshToken)
+	cfg.recordAuditEvent(req, auditSessionRevoked, stored.UserID, stored.UserID, "session "+stored.FamilyID.String())
+	if auth.UsesSessionCookies(req.Header) {
+		clearSessionCookies(rw)
+	}
 
 	respondWithJSON(rw, http.StatusNoContent, nil)
 }
+
+// createRefreshToken stores a new refresh token in familyID, tagged with
+// the device it was issued to and the access token issued alongside it,
+// and returns the plaintext token, which only the client ever sees.
+func createRefreshToken(req *http.Request, q *database.Queries, userID, familyID uuid.UUID, clientID uuid.NullUUID, access auth.AccessToken) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = q.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		FamilyID:  familyID,
+		UserAgent: requestUserAgent(req),
+		IpAddress: clientIP(req),
+		AccessJti: sql.NullString{String: access.ID, Valid: true},
+		// a little over the real expiry so the deny entry never lapses early
+		AccessTtlSeconds: int32(time.Until(access.ExpiresAt)/time.Second) + 1,
+		ClientID:         clientID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"sort"
 	"strings"
@@ -19,12 +20,34 @@ type Chirp struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Body      string    `json:"body"`
 	UserID    uuid.UUID `json:"user_id"`
+	Author    *Author   `json:"author,omitempty"`
+}
+
+// Author is the compact profile embedded in chirps with ?expand=author.
+type Author struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+// chirpExpansions lists the relations ?expand= accepts.
+var chirpExpansions = map[string]struct{}{
+	"author": {},
 }
 
 func (cfg *apiConfig) handlerGetChirps(rw http.ResponseWriter, req *http.Request) {
 	sortMethod := req.URL.Query().Get("sort")
 
-	var err error
+	viewerID := cfg.getViewerID(req)
+
+	expand, err := parseExpand(req)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
 	authorID := uuid.Nil
 	authorIDString := req.URL.Query().Get("author_id")
 	if authorIDString != "" {
@@ -35,15 +58,21 @@ func (cfg *apiConfig) handlerGetChirps(rw http.ResponseWriter, req *http.Request
 		}
 	}
 
-	chirps := []database.Chirp{}
+	chirps := []database.GetChirpsRow{}
 	if authorID != uuid.Nil {
-		chirps, err = cfg.dbQueries.GetChirpsFromUserID(req.Context(), authorID)
+		authorChirps, err := cfg.dbQueries.GetChirpsFromUserID(req.Context(), database.GetChirpsFromUserIDParams{
+			UserID:   authorID,
+			ViewerID: viewerID,
+		})
 		if err != nil {
 			respondWithError(rw, http.StatusInternalServerError, "Could not get chirps", err)
 			return
 		}
+		for _, c := range authorChirps {
+			chirps = append(chirps, database.GetChirpsRow(c))
+		}
 	} else {
-		chirps, err = cfg.dbQueries.GetChirps(req.Context())
+		chirps, err = cfg.dbQueries.GetChirps(req.Context(), viewerID)
 		if err != nil {
 			respondWithError(rw, http.StatusInternalServerError, "Could not get chirps", err)
 			return
@@ -52,14 +81,7 @@ func (cfg *apiConfig) handlerGetChirps(rw http.ResponseWriter, req *http.Request
 
 	chirpsResponse := []Chirp{}
 	for _, c := range chirps {
-		chirp := Chirp{
-			ID:        c.ID,
-			CreatedAt: c.CreatedAt,
-			UpdatedAt: c.UpdatedAt,
-			Body:      c.Body,
-			UserID:    c.UserID,
-		}
-		chirpsResponse = append(chirpsResponse, chirp)
+		chirpsResponse = append(chirpsResponse, chirpWithExpansions(c, expand))
 	}
 
 	if sortMethod == "desc" {
@@ -72,24 +94,30 @@ func (cfg *apiConfig) handlerGetChirps(rw http.ResponseWriter, req *http.Request
 }
 
 func (cfg *apiConfig) handlerGetChirp(rw http.ResponseWriter, req *http.Request) {
-	userID, err := uuid.Parse(req.PathValue("chirpID"))
+	viewerID := cfg.getViewerID(req)
+
+	expand, err := parseExpand(req)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
 	if err != nil {
 		respondWithError(rw, http.StatusInternalServerError, "Couldn't parse path value", err)
 		return
 	}
-	chirp, err := cfg.dbQueries.GetChirp(req.Context(), userID)
+	// chirps of protected accounts are reported as missing to non-followers
+	chirp, err := cfg.dbQueries.GetVisibleChirp(req.Context(), database.GetVisibleChirpParams{
+		ID:       chirpID,
+		ViewerID: viewerID,
+	})
 	if err != nil {
 		respondWithError(rw, http.StatusNotFound, "Couldn't find chirp", err)
 		return
 	}
 
-	respondWithJSON(rw, http.StatusOK, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	})
+	respondWithJSON(rw, http.StatusOK, chirpWithExpansions(database.GetChirpsRow(chirp), expand))
 }
 
 func (cfg *apiConfig) handlerPostChirp(rw http.ResponseWriter, req *http.Request) {
@@ -107,20 +135,17 @@ func (cfg *apiConfig) handlerPostChirp(rw http.ResponseWriter, req *http.Request
 		return
 	}
 
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeChirpsWrite)
+	if !ok {
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.secret)
-	if err != nil {
-		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+
+	if !cfg.requireVerifiedEmail(rw, req, userID) {
 		return
 	}
 
 	// in case response body length exceeds the limit
-	err = validateChirp(params.Body)
-	if err != nil {
+	if err := validateChirp(params.Body); err != nil {
 		respondWithError(rw, http.StatusBadRequest, "Chirp is too long", nil)
 		return
 	}
@@ -146,15 +171,8 @@ func (cfg *apiConfig) handlerPostChirp(rw http.ResponseWriter, req *http.Request
 }
 
 func (cfg *apiConfig) handlerDeleteChirp(rw http.ResponseWriter, req *http.Request) {
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
-		return
-	}
-
-	tokenUserID, err := auth.ValidateJWT(token, cfg.secret)
-	if err != nil {
-		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+	tokenUserID, ok := cfg.authenticate(rw, req, auth.ScopeChirpsWrite)
+	if !ok {
 		return
 	}
 
@@ -180,6 +198,47 @@ func (cfg *apiConfig) handlerDeleteChirp(rw http.ResponseWriter, req *http.Reque
 	respondWithJSON(rw, http.StatusNoContent, nil)
 }
 
+// parseExpand reads the comma separated ?expand= relations and rejects
+// any that chirps don't support.
+func parseExpand(req *http.Request) (map[string]struct{}, error) {
+	expand := map[string]struct{}{}
+	expandString := req.URL.Query().Get("expand")
+	if expandString == "" {
+		return expand, nil
+	}
+
+	for _, relation := range strings.Split(expandString, ",") {
+		relation = strings.TrimSpace(relation)
+		if _, ok := chirpExpansions[relation]; !ok {
+			return nil, fmt.Errorf("Unknown expand relation: %q", relation)
+		}
+		expand[relation] = struct{}{}
+	}
+
+	return expand, nil
+}
+
+func chirpWithExpansions(row database.GetChirpsRow, expand map[string]struct{}) Chirp {
+	chirp := Chirp{
+		ID:        row.Chirp.ID,
+		CreatedAt: row.Chirp.CreatedAt,
+		UpdatedAt: row.Chirp.UpdatedAt,
+		Body:      row.Chirp.Body,
+		UserID:    row.Chirp.UserID,
+	}
+	if _, ok := expand["author"]; ok {
+		chirp.Author = &Author{
+			ID:          row.Chirp.UserID,
+			Handle:      row.Handle.String,
+			DisplayName: row.DisplayName,
+			AvatarURL:   row.AvatarURL,
+			IsChirpyRed: row.IsChirpyRed,
+		}
+	}
+
+	return chirp
+}
+
 func validateChirp(chirpBody string) error {
 	const maxChirpLength = 140
 	if len(chirpBody) > maxChirpLength {
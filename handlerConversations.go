@@ -0,0 +1,355 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxConversationMembers caps group DMs, including the creator.
+const maxConversationMembers = 10
+
+type Conversation struct {
+	ID          uuid.UUID            `json:"id"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+	Members     []ConversationMember `json:"members"`
+	UnreadCount int64                `json:"unread_count"`
+}
+
+type ConversationMember struct {
+	UserID     uuid.UUID  `json:"user_id"`
+	JoinedAt   time.Time  `json:"joined_at"`
+	LastReadAt *time.Time `json:"last_read_at"`
+}
+
+type Message struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Body           string    `json:"body"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+}
+
+func (cfg *apiConfig) handlerCreateConversation(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		MemberIDs []uuid.UUID `json:"member_ids"`
+	}
+
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeMessagesWrite)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	// the creator is always a member, duplicates are dropped
+	memberIDs := []uuid.UUID{userID}
+	seen := map[uuid.UUID]struct{}{userID: {}}
+	for _, id := range params.MemberIDs {
+		if _, exists := seen[id]; exists {
+			continue
+		}
+		seen[id] = struct{}{}
+		memberIDs = append(memberIDs, id)
+	}
+	if len(memberIDs) < 2 {
+		respondWithError(rw, http.StatusBadRequest, "A conversation needs at least one other member", nil)
+		return
+	}
+	if len(memberIDs) > maxConversationMembers {
+		respondWithError(rw, http.StatusBadRequest, "Too many conversation members", nil)
+		return
+	}
+	for _, id := range memberIDs[1:] {
+		if !cfg.requireNotBlocked(rw, req, userID, id, "You can't start a conversation with a user you blocked or who blocked you") {
+			return
+		}
+	}
+
+	// one-to-one conversations are reused instead of duplicated
+	if len(memberIDs) == 2 {
+		existing, err := cfg.dbQueries.GetDirectConversation(req.Context(), database.GetDirectConversationParams{
+			UserID:   memberIDs[0],
+			UserID_2: memberIDs[1],
+		})
+		if err == nil {
+			cfg.respondWithConversation(rw, req, http.StatusOK, existing)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't look up conversation", err)
+			return
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create conversation", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	conversation, err := qtx.CreateConversation(req.Context())
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create conversation", err)
+		return
+	}
+	for _, id := range memberIDs {
+		err := qtx.AddConversationMember(req.Context(), database.AddConversationMemberParams{
+			ConversationID: conversation.ID,
+			UserID:         id,
+		})
+		if err != nil {
+			respondWithError(rw, http.StatusBadRequest, "Couldn't add conversation member", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create conversation", err)
+		return
+	}
+
+	cfg.respondWithConversation(rw, req, http.StatusCreated, conversation)
+}
+
+func (cfg *apiConfig) handlerGetConversations(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeMessagesRead)
+	if !ok {
+		return
+	}
+
+	conversations, err := cfg.dbQueries.GetConversationsForUser(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get conversations", err)
+		return
+	}
+
+	conversationsResponse := []Conversation{}
+	for _, c := range conversations {
+		members, err := cfg.getConversationMembers(req, c.ID)
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't get conversation members", err)
+			return
+		}
+		conversationsResponse = append(conversationsResponse, Conversation{
+			ID:          c.ID,
+			CreatedAt:   c.CreatedAt,
+			UpdatedAt:   c.UpdatedAt,
+			Members:     members,
+			UnreadCount: c.UnreadCount,
+		})
+	}
+
+	respondWithJSON(rw, http.StatusOK, conversationsResponse)
+}
+
+func (cfg *apiConfig) handlerPostMessage(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeMessagesWrite)
+	if !ok {
+		return
+	}
+
+	if !cfg.requireVerifiedEmail(rw, req, userID) {
+		return
+	}
+
+	conversationID, ok := cfg.authorizeConversation(rw, req, userID)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	if err := validateMessage(params.Body); err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	// a block between the sender and any member silences the sender there
+	blocked, err := cfg.dbQueries.ConversationHasBlock(req.Context(), database.ConversationHasBlockParams{
+		UserID:         userID,
+		ConversationID: conversationID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check blocks", err)
+		return
+	}
+	if blocked {
+		respondWithError(rw, http.StatusForbidden, "You can't message a conversation with a user you blocked or who blocked you", nil)
+		return
+	}
+
+	message, err := cfg.dbQueries.CreateMessage(req.Context(), database.CreateMessageParams{
+		Body:           params.Body,
+		ConversationID: conversationID,
+		SenderID:       userID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not send the message", err)
+		return
+	}
+	if err := cfg.dbQueries.TouchConversation(req.Context(), conversationID); err != nil {
+		log.Printf("Couldn't update conversation %s: %v", conversationID, err)
+	}
+
+	respondWithJSON(rw, http.StatusCreated, Message{
+		ID:             message.ID,
+		CreatedAt:      message.CreatedAt,
+		UpdatedAt:      message.UpdatedAt,
+		Body:           message.Body,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+	})
+}
+
+func (cfg *apiConfig) handlerGetMessages(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeMessagesRead)
+	if !ok {
+		return
+	}
+
+	conversationID, ok := cfg.authorizeConversation(rw, req, userID)
+	if !ok {
+		return
+	}
+
+	messages, err := cfg.dbQueries.GetMessages(req.Context(), conversationID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not get messages", err)
+		return
+	}
+
+	messagesResponse := []Message{}
+	for _, m := range messages {
+		messagesResponse = append(messagesResponse, Message{
+			ID:             m.ID,
+			CreatedAt:      m.CreatedAt,
+			UpdatedAt:      m.UpdatedAt,
+			Body:           m.Body,
+			ConversationID: m.ConversationID,
+			SenderID:       m.SenderID,
+		})
+	}
+
+	respondWithJSON(rw, http.StatusOK, messagesResponse)
+}
+
+func (cfg *apiConfig) handlerReadConversation(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeMessagesWrite)
+	if !ok {
+		return
+	}
+
+	conversationID, ok := cfg.authorizeConversation(rw, req, userID)
+	if !ok {
+		return
+	}
+
+	err := cfg.dbQueries.MarkConversationRead(req.Context(), database.MarkConversationReadParams{
+		ConversationID: conversationID,
+		UserID:         userID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't mark conversation as read", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+// authorizeConversation parses the conversation ID from the path and makes
+// sure the user is a member. Non-members get a 404 so conversation IDs don't leak.
+func (cfg *apiConfig) authorizeConversation(rw http.ResponseWriter, req *http.Request, userID uuid.UUID) (uuid.UUID, bool) {
+	conversationID, err := uuid.Parse(req.PathValue("conversationID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid conversation ID", err)
+		return uuid.Nil, false
+	}
+
+	_, err = cfg.dbQueries.GetConversationMember(req.Context(), database.GetConversationMemberParams{
+		ConversationID: conversationID,
+		UserID:         userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusNotFound, "Couldn't find conversation", err)
+			return uuid.Nil, false
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get conversation", err)
+		return uuid.Nil, false
+	}
+
+	return conversationID, true
+}
+
+func (cfg *apiConfig) getConversationMembers(req *http.Request, conversationID uuid.UUID) ([]ConversationMember, error) {
+	members, err := cfg.dbQueries.GetConversationMembers(req.Context(), conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	membersResponse := []ConversationMember{}
+	for _, m := range members {
+		member := ConversationMember{
+			UserID:   m.UserID,
+			JoinedAt: m.JoinedAt,
+		}
+		if m.LastReadAt.Valid {
+			member.LastReadAt = &m.LastReadAt.Time
+		}
+		membersResponse = append(membersResponse, member)
+	}
+
+	return membersResponse, nil
+}
+
+func (cfg *apiConfig) respondWithConversation(rw http.ResponseWriter, req *http.Request, statusCode int, conversation database.Conversation) {
+	members, err := cfg.getConversationMembers(req, conversation.ID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get conversation members", err)
+		return
+	}
+
+	respondWithJSON(rw, statusCode, Conversation{
+		ID:        conversation.ID,
+		CreatedAt: conversation.CreatedAt,
+		UpdatedAt: conversation.UpdatedAt,
+		Members:   members,
+	})
+}
+
+func validateMessage(messageBody string) error {
+	const maxMessageLength = 1000
+	if messageBody == "" {
+		return errors.New("Message is empty")
+	}
+	if len(messageBody) > maxMessageLength {
+		return errors.New("Message is too long")
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	followStatusPending  = "pending"
+	followStatusAccepted = "accepted"
+)
+
+type Follow struct {
+	FollowerID uuid.UUID `json:"follower_id"`
+	FolloweeID uuid.UUID `json:"followee_id"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (cfg *apiConfig) handlerFollowUser(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	followeeID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	if followeeID == userID {
+		respondWithError(rw, http.StatusBadRequest, "You can't follow yourself", nil)
+		return
+	}
+	if !cfg.requireNotBlocked(rw, req, userID, followeeID, "You can't follow this user") {
+		return
+	}
+
+	followee, err := cfg.dbQueries.GetUserByID(req.Context(), followeeID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusNotFound, "user not found", err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	// protected accounts have to approve their followers
+	status := followStatusAccepted
+	if followee.IsProtected {
+		status = followStatusPending
+	}
+
+	follow, err := cfg.dbQueries.CreateFollow(req.Context(), database.CreateFollowParams{
+		FollowerID: userID,
+		FolloweeID: followee.ID,
+		Status:     status,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't follow user", err)
+		return
+	}
+
+	statusCode := http.StatusOK
+	if follow.Status == followStatusPending {
+		statusCode = http.StatusAccepted
+	}
+	respondWithJSON(rw, statusCode, databaseFollowToFollow(follow))
+}
+
+func (cfg *apiConfig) handlerUnfollowUser(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	followeeID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	err = cfg.dbQueries.DeleteFollow(req.Context(), database.DeleteFollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't unfollow user", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerGetFollowRequests(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersRead)
+	if !ok {
+		return
+	}
+
+	requests, err := cfg.dbQueries.GetFollowRequests(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get follow requests", err)
+		return
+	}
+
+	requestsResponse := []Follow{}
+	for _, r := range requests {
+		requestsResponse = append(requestsResponse, databaseFollowToFollow(r))
+	}
+
+	respondWithJSON(rw, http.StatusOK, requestsResponse)
+}
+
+func (cfg *apiConfig) handlerApproveFollowRequest(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	followerID, err := uuid.Parse(req.PathValue("followerID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid follower ID", err)
+		return
+	}
+
+	follow, err := cfg.dbQueries.AcceptFollowRequest(req.Context(), database.AcceptFollowRequestParams{
+		FollowerID: followerID,
+		FolloweeID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusNotFound, "Couldn't find follow request", err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't approve follow request", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, databaseFollowToFollow(follow))
+}
+
+func (cfg *apiConfig) handlerDenyFollowRequest(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	followerID, err := uuid.Parse(req.PathValue("followerID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid follower ID", err)
+		return
+	}
+
+	deleted, err := cfg.dbQueries.DenyFollowRequest(req.Context(), database.DenyFollowRequestParams{
+		FollowerID: followerID,
+		FolloweeID: userID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't deny follow request", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(rw, http.StatusNotFound, "Couldn't find follow request", nil)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+func databaseFollowToFollow(follow database.Follow) Follow {
+	return Follow{
+		FollowerID: follow.FollowerID,
+		FolloweeID: follow.FolloweeID,
+		Status:     follow.Status,
+		CreatedAt:  follow.CreatedAt,
+		UpdatedAt:  follow.UpdatedAt,
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxInviteBatchSize  = 100
+	maxInviteUses       = 1000
+	maxInviteExpiryDays = 365
+)
+
+const (
+	inviteStatusActive  = "active"
+	inviteStatusUsedUp  = "used_up"
+	inviteStatusExpired = "expired"
+)
+
+type Invite struct {
+	ID            uuid.UUID          `json:"id"`
+	BatchID       *uuid.UUID         `json:"batch_id,omitempty"`
+	MaxUses       int32              `json:"max_uses"`
+	UsesRemaining int32              `json:"uses_remaining"`
+	Status        string             `json:"status"`
+	ExpiresAt     *time.Time         `json:"expires_at"`
+	CreatedAt     time.Time          `json:"created_at"`
+	Redemptions   []InviteRedemption `json:"redemptions"`
+	// Code is only set in the response that creates the invite.
+	Code string `json:"code,omitempty"`
+}
+
+type InviteRedemption struct {
+	UserID     uuid.UUID `json:"user_id"`
+	Handle     string    `json:"handle"`
+	RedeemedAt time.Time `json:"redeemed_at"`
+}
+
+// handlerCreateInvites mints a batch of invites for an admin to hand out.
+// Batches don't count toward the admin's own quota.
+func (cfg *apiConfig) handlerCreateInvites(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Count         int `json:"count"`
+		MaxUses       int `json:"max_uses"`
+		ExpiresInDays int `json:"expires_in_days"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{Count: 1, MaxUses: 1}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	if params.Count < 1 || params.Count > maxInviteBatchSize {
+		respondWithError(rw, http.StatusBadRequest, fmt.Sprintf("count must be 1-%d", maxInviteBatchSize), nil)
+		return
+	}
+	if params.MaxUses < 1 || params.MaxUses > maxInviteUses {
+		respondWithError(rw, http.StatusBadRequest, fmt.Sprintf("max_uses must be 1-%d", maxInviteUses), nil)
+		return
+	}
+	if params.ExpiresInDays < 0 || params.ExpiresInDays > maxInviteExpiryDays {
+		respondWithError(rw, http.StatusBadRequest, fmt.Sprintf("expires_in_days must be 0-%d", maxInviteExpiryDays), nil)
+		return
+	}
+
+	adminID := requestActorID(req)
+	batchID := uuid.New()
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create invites", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	invites := []Invite{}
+	for range params.Count {
+		code, err := auth.MakeInviteCode()
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't create invite code", err)
+			return
+		}
+		created, err := qtx.CreateInvite(req.Context(), database.CreateInviteParams{
+			CodeHash:  auth.HashToken(auth.NormalizeInviteCode(code)),
+			InviterID: adminID,
+			BatchID:   uuid.NullUUID{UUID: batchID, Valid: true},
+			MaxUses:   int32(params.MaxUses),
+			// 0 means the invite never expires
+			ExpiresInDays: sql.NullInt32{Int32: int32(params.ExpiresInDays), Valid: params.ExpiresInDays > 0},
+		})
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't create invites", err)
+			return
+		}
+
+		invite := databaseInviteToInvite(created, nil)
+		invite.Code = code
+		invites = append(invites, invite)
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create invites", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditInvitesCreated, adminID, uuid.Nil, fmt.Sprintf("batch %s of %d", batchID, params.Count))
+	respondWithJSON(rw, http.StatusCreated, invites)
+}
+
+// handlerCreateUserInvite lets a user invite someone, up to their quota.
+func (cfg *apiConfig) handlerCreateUserInvite(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		ExpiresInDays int `json:"expires_in_days"`
+	}
+
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	if !cfg.requireVerifiedEmail(rw, req, userID) {
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+	if params.ExpiresInDays < 0 || params.ExpiresInDays > maxInviteExpiryDays {
+		respondWithError(rw, http.StatusBadRequest, fmt.Sprintf("expires_in_days must be 0-%d", maxInviteExpiryDays), nil)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create invite", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// locking the user row makes parallel requests take turns, so they
+	// can't all pass the quota check
+	if _, err := qtx.GetUserByIDForUpdate(req.Context(), userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	count, err := qtx.CountUserInvites(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't count invites", err)
+		return
+	}
+	if count >= int64(cfg.inviteQuota) {
+		respondWithError(rw, http.StatusForbidden, fmt.Sprintf("You've used all %d of your invites", cfg.inviteQuota), nil)
+		return
+	}
+
+	code, err := auth.MakeInviteCode()
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create invite code", err)
+		return
+	}
+	created, err := qtx.CreateInvite(req.Context(), database.CreateInviteParams{
+		CodeHash:      auth.HashToken(auth.NormalizeInviteCode(code)),
+		InviterID:     userID,
+		MaxUses:       1,
+		ExpiresInDays: sql.NullInt32{Int32: int32(params.ExpiresInDays), Valid: params.ExpiresInDays > 0},
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create invite", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create invite", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditInvitesCreated, userID, userID, "invite "+created.ID.String())
+
+	invite := databaseInviteToInvite(created, nil)
+	invite.Code = code
+	respondWithJSON(rw, http.StatusCreated, invite)
+}
+
+// handlerGetUserInvites lists the invites the user has made, including
+// admin batches, with who signed up with each.
+func (cfg *apiConfig) handlerGetUserInvites(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	invites, err := cfg.dbQueries.GetUserInvites(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get invites", err)
+		return
+	}
+	redemptions, err := cfg.dbQueries.GetUserInviteRedemptions(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get invite redemptions", err)
+		return
+	}
+
+	byInvite := map[uuid.UUID][]InviteRedemption{}
+	for _, r := range redemptions {
+		byInvite[r.InviteID] = append(byInvite[r.InviteID], InviteRedemption{
+			UserID:     r.UserID,
+			Handle:     r.Handle.String,
+			RedeemedAt: r.RedeemedAt,
+		})
+	}
+
+	invitesResponse := []Invite{}
+	for _, invite := range invites {
+		invitesResponse = append(invitesResponse, databaseInviteToInvite(invite, byInvite[invite.ID]))
+	}
+
+	respondWithJSON(rw, http.StatusOK, invitesResponse)
+}
+
+func databaseInviteToInvite(invite database.Invite, redemptions []InviteRedemption) Invite {
+	resp := Invite{
+		ID:            invite.ID,
+		MaxUses:       invite.MaxUses,
+		UsesRemaining: invite.UsesRemaining,
+		Status:        inviteStatusActive,
+		CreatedAt:     invite.CreatedAt,
+		Redemptions:   redemptions,
+	}
+	if resp.Redemptions == nil {
+		resp.Redemptions = []InviteRedemption{}
+	}
+	if invite.BatchID.Valid {
+		resp.BatchID = &invite.BatchID.UUID
+	}
+	if invite.ExpiresAt.Valid {
+		resp.ExpiresAt = &invite.ExpiresAt.Time
+	}
+
+	switch {
+	case invite.UsesRemaining == 0:
+		resp.Status = inviteStatusUsedUp
+	case invite.ExpiresAt.Valid && !invite.ExpiresAt.Time.After(time.Now()):
+		resp.Status = inviteStatusExpired
+	}
+	return resp
+}
@@ -0,0 +1,10 @@
+package main
+
+import "net/http"
+
+// handlerJWKS publishes the public keys access tokens are signed with so
+// other services can verify them without sharing a secret.
+func (cfg *apiConfig) handlerJWKS(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(rw, http.StatusOK, cfg.jwtKeys.JWKS())
+}
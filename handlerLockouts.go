@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	lockoutScopeAccount = "account"
+	lockoutScopeIP      = "ip"
+	lockoutEventsLimit  = 100
+)
+
+var (
+	accountLockoutPolicy = auth.LockoutPolicy{Threshold: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+	// an IP gets more slack since several users may share it
+	ipLockoutPolicy = auth.LockoutPolicy{Threshold: 20, BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+)
+
+type Lockout struct {
+	Scope       string    `json:"scope"`
+	Subject     string    `json:"subject"`
+	Failures    int32     `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+type LockoutEvent struct {
+	ID          uuid.UUID `json:"id"`
+	Scope       string    `json:"scope"`
+	Subject     string    `json:"subject"`
+	Failures    int32     `json:"failures"`
+	IPAddress   string    `json:"ip_address"`
+	CreatedAt   time.Time `json:"created_at"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+func (cfg *apiConfig) handlerGetLockouts(rw http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Active []Lockout      `json:"active"`
+		Events []LockoutEvent `json:"events"`
+	}
+
+	active, err := cfg.dbQueries.GetActiveLockouts(req.Context())
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get lockouts", err)
+		return
+	}
+	events, err := cfg.dbQueries.GetLockoutEvents(req.Context(), lockoutEventsLimit)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get lockout events", err)
+		return
+	}
+
+	resp := response{Active: []Lockout{}, Events: []LockoutEvent{}}
+	for _, l := range active {
+		resp.Active = append(resp.Active, Lockout{
+			Scope:       l.Scope,
+			Subject:     l.Subject,
+			Failures:    l.Failures,
+			LockedUntil: l.LockedUntil.Time,
+		})
+	}
+	for _, e := range events {
+		resp.Events = append(resp.Events, databaseLockoutEventToLockoutEvent(e))
+	}
+
+	respondWithJSON(rw, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerUnlockLogin(rw http.ResponseWriter, req *http.Request) {
+	scope := req.PathValue("scope")
+	subject := req.PathValue("subject")
+	switch scope {
+	case lockoutScopeAccount:
+		subject = normalizeLoginEmail(subject)
+	case lockoutScopeIP:
+	default:
+		respondWithError(rw, http.StatusBadRequest, "Scope must be account or ip", nil)
+		return
+	}
+
+	deleted, err := cfg.dbQueries.ResetLoginThrottle(req.Context(), database.ResetLoginThrottleParams{
+		Scope:   scope,
+		Subject: subject,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't unlock", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(rw, http.StatusNotFound, "Couldn't find lockout", nil)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditAdminLockoutCleared, requestActorID(req), uuid.Nil, scope+" "+subject)
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+// checkLoginLockout responds with 429 and returns false while the email
+// or the client's IP is locked out. It doesn't look at whether the
+// account exists.
+func (cfg *apiConfig) checkLoginLockout(rw http.ResponseWriter, req *http.Request, email string) bool {
+	retryAfter, err := cfg.dbQueries.GetLoginLockoutSeconds(req.Context(), database.GetLoginLockoutSecondsParams{
+		Email:     email,
+		IpAddress: clientIP(req),
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check login lockout", err)
+		return false
+	}
+	if retryAfter > 0 {
+		rw.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+		respondWithError(rw, http.StatusTooManyRequests, "Too many failed login attempts, try again later", nil)
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed attempt against the email and the
+// client's IP and locks either out once its policy says so.
+func (cfg *apiConfig) recordLoginFailure(req *http.Request, email string) {
+	ctx := req.Context()
+	ip := clientIP(req)
+	keys := []struct {
+		scope   string
+		subject string
+		policy  auth.LockoutPolicy
+	}{
+		{lockoutScopeAccount, email, accountLockoutPolicy},
+		{lockoutScopeIP, ip, ipLockoutPolicy},
+	}
+
+	for _, k := range keys {
+		throttle, err := cfg.dbQueries.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Scope:   k.scope,
+			Subject: k.subject,
+		})
+		if err != nil {
+			log.Printf("Couldn't record login failure: %v", err)
+			continue
+		}
+
+		lock := k.policy.Duration(int(throttle.Failures))
+		if lock == 0 {
+			continue
+		}
+		lockSeconds := int32(lock / time.Second)
+		err = cfg.dbQueries.LockLoginThrottle(ctx, database.LockLoginThrottleParams{
+			LockSeconds: lockSeconds,
+			Scope:       k.scope,
+			Subject:     k.subject,
+		})
+		if err != nil {
+			log.Printf("Couldn't lock login: %v", err)
+			continue
+		}
+		err = cfg.dbQueries.CreateLockoutEvent(ctx, database.CreateLockoutEventParams{
+			Scope:       k.scope,
+			Subject:     k.subject,
+			Failures:    throttle.Failures,
+			IpAddress:   ip,
+			LockSeconds: lockSeconds,
+		})
+		if err != nil {
+			log.Printf("Couldn't record lockout event: %v", err)
+		}
+	}
+}
+
+// clearLoginFailures resets the account's counter after a successful
+// login. The IP counter is left alone so one valid account can't be used
+// to keep guessing others from the same address.
+func (cfg *apiConfig) clearLoginFailures(ctx context.Context, email string) {
+	_, err := cfg.dbQueries.ResetLoginThrottle(ctx, database.ResetLoginThrottleParams{
+		Scope:   lockoutScopeAccount,
+		Subject: email,
+	})
+	if err != nil {
+		log.Printf("Couldn't clear login failures: %v", err)
+	}
+}
+
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func databaseLockoutEventToLockoutEvent(event database.LockoutEvent) LockoutEvent {
+	return LockoutEvent{
+		ID:          event.ID,
+		Scope:       event.Scope,
+		Subject:     event.Subject,
+		Failures:    event.Failures,
+		IPAddress:   event.IpAddress,
+		CreatedAt:   event.CreatedAt,
+		LockedUntil: event.LockedUntil,
+	}
+}
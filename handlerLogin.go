@@ -1,25 +1,27 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/bencuci/chirpy/internal/auth"
 	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
+const twoFactorChallengeExpiry = 5 * time.Minute
+
 func (cfg *apiConfig) handlerLogin(rw http.ResponseWriter, req *http.Request) {
 	type parameters struct {
 		Password         string `json:"password"`
 		Email            string `json:"email"`
 		ExpiresInSeconds int    `json:"expires_in_seconds"`
-	}
-
-	type response struct {
-		User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
+		UseCookies       bool   `json:"use_cookies"`
 	}
 
 	decoder := json.NewDecoder(req.Body)
@@ -29,41 +31,128 @@ func (cfg *apiConfig) handlerLogin(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if params.ExpiresInSeconds <= 0 || params.ExpiresInSeconds > 3600 {
-		params.ExpiresInSeconds = 3600
+	email := normalizeLoginEmail(params.Email)
+	if !cfg.checkLoginLockout(rw, req, email) {
+		return
 	}
 
-	user, err := cfg.dbQueries.GetUser(req.Context(), params.Email)
-	if err != nil || auth.CheckPasswordHash(params.Password, user.HashedPassword) != nil {
+	user, err := cfg.dbQueries.GetUser(req.Context(), email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if err != nil {
+		cfg.passwordHasher.CheckDummy(params.Password)
+		cfg.recordLoginFailure(req, email)
+		cfg.recordAuditEvent(req, auditLoginFailed, uuid.Nil, uuid.Nil, "unknown email "+email)
+		respondWithError(rw, http.StatusUnauthorized, "Incorrect mail or password", err)
+		return
+	}
+	// accounts created through an identity provider have no password
+	if !user.HashedPassword.Valid {
+		cfg.passwordHasher.CheckDummy(params.Password)
+		cfg.recordLoginFailure(req, email)
+		cfg.recordAuditEvent(req, auditLoginFailed, uuid.Nil, user.ID, "no password set")
+		respondWithError(rw, http.StatusUnauthorized, "Incorrect mail or password", nil)
+		return
+	}
+	if err := cfg.passwordHasher.Check(params.Password, user.HashedPassword.String); err != nil {
+		cfg.recordLoginFailure(req, email)
+		cfg.recordAuditEvent(req, auditLoginFailed, uuid.Nil, user.ID, "wrong password")
 		respondWithError(rw, http.StatusUnauthorized, "Incorrect mail or password", err)
 		return
 	}
 
-	token, err := auth.MakeJWT(user.ID, cfg.secret, time.Duration(params.ExpiresInSeconds)*time.Second)
+	// the plaintext is only ever available here, so this is where hashes
+	// from an older algorithm or cost get upgraded
+	if cfg.passwordHasher.NeedsRehash(user.HashedPassword.String) {
+		cfg.rehashPassword(req.Context(), user.ID, params.Password)
+	}
+
+	// with 2FA on, the password only earns a challenge for POST /api/login/2fa
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithTwoFactorChallenge(rw, user)
+		return
+	}
+
+	cfg.clearLoginFailures(req.Context(), email)
+	cfg.respondWithSession(rw, req, user, params.ExpiresInSeconds, params.UseCookies)
+}
+
+// respondWithTwoFactorChallenge answers the first factor of a login for a
+// user with 2FA on. The challenge is exchanged at POST /api/login/2fa.
+func (cfg *apiConfig) respondWithTwoFactorChallenge(rw http.ResponseWriter, user database.User) {
+	type response struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+	}
+
+	challenge, err := auth.MakeChallengeJWT(user.ID, cfg.jwtKeys, twoFactorChallengeExpiry)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not create challenge token", err)
+		return
+	}
+	respondWithJSON(rw, http.StatusOK, response{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+	})
+}
+
+// respondWithSession issues an access token and a refresh token for a
+// user who has fully authenticated. Browser clients can ask for them as
+// cookies instead of in the body.
+func (cfg *apiConfig) respondWithSession(rw http.ResponseWriter, req *http.Request, user database.User, expiresInSeconds int, useCookies bool) {
+	type response struct {
+		User
+		Token        string `json:"token,omitempty"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		CSRFToken    string `json:"csrf_token,omitempty"`
+	}
+
+	if expiresInSeconds <= 0 || expiresInSeconds > 3600 {
+		expiresInSeconds = 3600
+	}
+
+	token, err := auth.MakeAccessToken(user.ID, auth.Role(user.Role), cfg.jwtKeys, time.Duration(expiresInSeconds)*time.Second)
 	if err != nil {
 		respondWithError(rw, http.StatusInternalServerError, "Could not create jwt token: %v", err)
 		return
 	}
 
-	refreshToken, err := auth.MakeRefreshToken()
-	_, err = cfg.dbQueries.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
-		Token:  refreshToken,
-		UserID: user.ID,
-	})
+	// each login starts a new refresh token family
+	refreshToken, err := createRefreshToken(req, cfg.dbQueries, user.ID, uuid.New(), uuid.NullUUID{}, token)
 	if err != nil {
 		respondWithError(rw, http.StatusInternalServerError, "Could not create jwt refresh token", err)
 		return
 	}
 
-	respondWithJSON(rw, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
-		Token:        token,
-		RefreshToken: refreshToken,
+	resp := response{User: databaseUserToUser(user)}
+	if useCookies {
+		resp.CSRFToken, err = setSessionCookies(rw, token, refreshToken)
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Could not create CSRF token", err)
+			return
+		}
+	} else {
+		resp.Token = token.Token
+		resp.RefreshToken = refreshToken
+	}
+
+	cfg.recordAuditEvent(req, auditLoginSucceeded, user.ID, user.ID, "")
+	respondWithJSON(rw, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) rehashPassword(ctx context.Context, userID uuid.UUID, password string) {
+	hashedPW, err := cfg.passwordHasher.Hash(password)
+	if err != nil {
+		log.Printf("Couldn't rehash password: %v", err)
+		return
+	}
+	err = cfg.dbQueries.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		HashedPassword: sql.NullString{String: hashedPW, Valid: true},
+		ID:             userID,
 	})
+	if err != nil {
+		log.Printf("Couldn't store rehashed password: %v", err)
+	}
 }
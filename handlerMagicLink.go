@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/bencuci/chirpy/internal/mailer"
+)
+
+const (
+	// magicLinkNonceCookie binds a link to the browser that asked for it,
+	// so a link read out of someone's mailbox is useless elsewhere.
+	magicLinkNonceCookie     = "chirpy_magic_nonce"
+	magicLinkNonceCookiePath = "/api/login/magic"
+	magicLinkExpiry          = 15 * time.Minute
+	magicLinkEmailTimeout    = 30 * time.Second
+	// magicLinkMaxRequests links can be asked for per email every 15 minutes
+	magicLinkMaxRequests = 3
+)
+
+// handlerRequestMagicLink emails a one-time login link. Like the password
+// reset, the response is the same whether or not the account exists.
+func (cfg *apiConfig) handlerRequestMagicLink(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	type response struct {
+		Message string `json:"message"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	email := normalizeLoginEmail(params.Email)
+	if email == "" {
+		respondWithError(rw, http.StatusBadRequest, "Email is required", nil)
+		return
+	}
+
+	// requests for the same email queue up behind each other, so parallel
+	// ones can't all slip under the limit
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check the rate limit", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	if err := qtx.LockMagicLinkRequests(req.Context(), email); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check the rate limit", err)
+		return
+	}
+	retryAfter, err := qtx.GetMagicLinkRetrySeconds(req.Context(), database.GetMagicLinkRetrySecondsParams{
+		MaxRequests: magicLinkMaxRequests,
+		Email:       email,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check the rate limit", err)
+		return
+	}
+	if retryAfter > 0 {
+		rw.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+		respondWithError(rw, http.StatusTooManyRequests, "Too many login links requested, try again later", nil)
+		return
+	}
+	if err := qtx.CreateMagicLinkRequest(req.Context(), email); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't record the request", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't record the request", err)
+		return
+	}
+	if err := cfg.dbQueries.DeleteOldMagicLinkRequests(req.Context()); err != nil {
+		log.Printf("Couldn't delete old login link requests: %v", err)
+	}
+
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create nonce", err)
+		return
+	}
+	// a newer request from the same browser replaces the cookie, so only
+	// the latest link works there
+	http.SetCookie(rw, &http.Cookie{
+		Name:     magicLinkNonceCookie,
+		Value:    nonce,
+		Path:     magicLinkNonceCookiePath,
+		MaxAge:   int(magicLinkExpiry / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	go func(email, nonce string) {
+		ctx, cancel := context.WithTimeout(context.Background(), magicLinkEmailTimeout)
+		defer cancel()
+		if err := cfg.sendMagicLinkEmail(ctx, email, nonce); err != nil {
+			log.Printf("Couldn't send login link: %v", err)
+		}
+	}(params.Email, nonce)
+
+	respondWithJSON(rw, http.StatusAccepted, response{
+		Message: "If an account with that email exists, a login link has been sent.",
+	})
+}
+
+// handlerVerifyMagicLink logs in with a link's token. It only works in the
+// browser that asked for the link, once, within 15 minutes, and not after
+// the account's email has changed.
+func (cfg *apiConfig) handlerVerifyMagicLink(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Token            string `json:"token"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+		UseCookies       bool   `json:"use_cookies"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	nonce, err := req.Cookie(magicLinkNonceCookie)
+	if err != nil || nonce.Value == "" {
+		respondWithError(rw, http.StatusUnauthorized, "Open the link in the browser you requested it from", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	userID, err := qtx.UseMagicLinkToken(req.Context(), database.UseMagicLinkTokenParams{
+		TokenHash: auth.HashToken(params.Token),
+		NonceHash: auth.HashToken(nonce.Value),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(rw, http.StatusUnauthorized, "Invalid or expired login link, or it was requested from another browser", err)
+		return
+	}
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+	if err := qtx.DeleteMagicLinkTokens(req.Context(), userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+	// following the link proves the user can read mail sent to the address
+	user, err := qtx.VerifyUserEmail(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't log in", err)
+		return
+	}
+
+	http.SetCookie(rw, &http.Cookie{
+		Name:   magicLinkNonceCookie,
+		Path:   magicLinkNonceCookiePath,
+		MaxAge: -1,
+		Secure: true,
+	})
+
+	// the link stands in for the password, not for the second factor
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithTwoFactorChallenge(rw, user)
+		return
+	}
+
+	cfg.clearLoginFailures(req.Context(), normalizeLoginEmail(user.Email))
+	cfg.respondWithSession(rw, req, user, params.ExpiresInSeconds, params.UseCookies)
+}
+
+func (cfg *apiConfig) sendMagicLinkEmail(ctx context.Context, email, nonce string) error {
+	user, err := cfg.dbQueries.GetUser(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.dbQueries.CreateMagicLinkToken(ctx, database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		NonceHash: auth.HashToken(nonce),
+		Email:     user.Email,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't store login link token: %w", err)
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy login link",
+		Body: fmt.Sprintf(
+			"Someone asked to log in to Chirpy as you. If it was you, open this link in the same browser:\n\n%s/app/#magic_token=%s\n\nor send the token to POST /api/login/magic/verify from it. The link works once and expires in 15 minutes. If it wasn't you, you can ignore this email.",
+			cfg.baseURL,
+			token,
+		),
+	})
+}
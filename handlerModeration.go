@@ -0,0 +1,38 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// handlerRemoveChirp lets moderators take down any chirp. The author is
+// recorded as the target so the removal shows up in their security events.
+func (cfg *apiConfig) handlerRemoveChirp(rw http.ResponseWriter, req *http.Request) {
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirp(req.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusNotFound, "Couldn't find chirp", err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get chirp", err)
+		return
+	}
+
+	if err := cfg.dbQueries.DeleteChirp(req.Context(), chirp.ID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't remove chirp", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditChirpRemoved, requestActorID(req), chirp.UserID, "chirp "+chirp.ID.String())
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Mute struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// handlerMuteUser hides a user's chirps from the muter's timeline without
+// them knowing. Unlike a block it doesn't touch follows.
+func (cfg *apiConfig) handlerMuteUser(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	mutedID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	if mutedID == userID {
+		respondWithError(rw, http.StatusBadRequest, "You can't mute yourself", nil)
+		return
+	}
+
+	if _, err := cfg.dbQueries.GetUserByID(req.Context(), mutedID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusNotFound, "user not found", err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	err = cfg.dbQueries.CreateMute(req.Context(), database.CreateMuteParams{
+		MuterID: userID,
+		MutedID: mutedID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't mute user", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerUnmuteUser(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	mutedID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	err = cfg.dbQueries.DeleteMute(req.Context(), database.DeleteMuteParams{
+		MuterID: userID,
+		MutedID: mutedID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't unmute user", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerGetMutes(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersRead)
+	if !ok {
+		return
+	}
+
+	mutes, err := cfg.dbQueries.GetMutes(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get muted users", err)
+		return
+	}
+
+	mutesResponse := []Mute{}
+	for _, m := range mutes {
+		mutesResponse = append(mutesResponse, Mute{
+			UserID:    m.MutedID,
+			CreatedAt: m.CreatedAt,
+		})
+	}
+
+	respondWithJSON(rw, http.StatusOK, mutesResponse)
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const oauthAccessTokenExpiry = time.Hour
+
+// scopeDescriptions are shown on the consent page.
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:    "Read chirps, including ones only your followers can see",
+	auth.ScopeChirpsWrite:   "Post and delete chirps as you",
+	auth.ScopeUsersRead:     "See your follow requests, suggestions, blocks and mutes",
+	auth.ScopeUsersWrite:    "Edit your profile, follow, block and mute people and answer follow requests",
+	auth.ScopeMessagesRead:  "Read your direct messages",
+	auth.ScopeMessagesWrite: "Start conversations and send direct messages as you",
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<html>
+	<body>
+		<h1>Authorize {{.ClientName}}</h1>
+		<p>{{.ClientName}} wants to:</p>
+		<ul>
+			{{range .Scopes}}<li>{{.}}</li>
+			{{end}}
+		</ul>
+		<form method="POST" action="/api/oauth/authorize">
+			<input type="hidden" name="response_type" value="code">
+			<input type="hidden" name="client_id" value="{{.ClientID}}">
+			<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+			<input type="hidden" name="scope" value="{{.Scope}}">
+			<input type="hidden" name="state" value="{{.State}}">
+			<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+			<input type="hidden" name="code_challenge_method" value="S256">
+			<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+			<button type="submit" name="decision" value="approve">Allow</button>
+			<button type="submit" name="decision" value="deny">Deny</button>
+		</form>
+	</body>
+</html>
+`))
+
+// authorizationRequest is a validated RFC 6749 authorization request.
+type authorizationRequest struct {
+	client        database.OauthClient
+	redirectURI   string
+	scopes        string
+	state         string
+	codeChallenge string
+}
+
+// handlerAuthorize shows the logged in user what an app is asking for.
+// The form posts back to handlerAuthorizeDecision.
+func (cfg *apiConfig) handlerAuthorize(rw http.ResponseWriter, req *http.Request) {
+	type consentPage struct {
+		ClientName    string
+		ClientID      uuid.UUID
+		RedirectURI   string
+		Scope         string
+		Scopes        []string
+		State         string
+		CodeChallenge string
+		CSRFToken     string
+	}
+
+	ar, oauthErr, err := cfg.parseAuthorizationRequest(req)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if oauthErr != "" {
+		redirectWithAuthorizationResult(rw, req, ar, url.Values{"error": {oauthErr}})
+		return
+	}
+
+	if _, ok := cfg.authenticateForConsent(rw, req); !ok {
+		return
+	}
+
+	page := consentPage{
+		ClientName:    ar.client.Name,
+		ClientID:      ar.client.ID,
+		RedirectURI:   ar.redirectURI,
+		Scope:         ar.scopes,
+		State:         ar.state,
+		CodeChallenge: ar.codeChallenge,
+	}
+	for _, scope := range strings.Fields(ar.scopes) {
+		page.Scopes = append(page.Scopes, scopeDescriptions[scope])
+	}
+	// only cookie sessions need it, bearer clients pass the CSRF check anyway
+	page.CSRFToken, _ = auth.GetCSRFCookie(req.Header)
+
+	rw.Header().Set("Content-Type", "text/html")
+	rw.Header().Set("X-Frame-Options", "DENY")
+	rw.WriteHeader(http.StatusOK)
+	if err := consentTemplate.Execute(rw, page); err != nil {
+		log.Printf("Couldn't render consent page: %v", err)
+	}
+}
+
+func (cfg *apiConfig) handlerAuthorizeDecision(rw http.ResponseWriter, req *http.Request) {
+	ar, oauthErr, err := cfg.parseAuthorizationRequest(req)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if oauthErr != "" {
+		redirectWithAuthorizationResult(rw, req, ar, url.Values{"error": {oauthErr}})
+		return
+	}
+
+	userID, ok := cfg.authenticateForConsent(rw, req)
+	if !ok {
+		return
+	}
+
+	if req.FormValue("decision") != "approve" {
+		redirectWithAuthorizationResult(rw, req, ar, url.Values{"error": {"access_denied"}})
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create authorization code", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't authorize app", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	_, err = qtx.UpsertOAuthGrant(req.Context(), database.UpsertOAuthGrantParams{
+		UserID:   userID,
+		ClientID: ar.client.ID,
+		Scopes:   ar.scopes,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't authorize app", err)
+		return
+	}
+	err = qtx.CreateOAuthAuthorizationCode(req.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      ar.client.ID,
+		UserID:        userID,
+		RedirectUri:   ar.redirectURI,
+		Scopes:        ar.scopes,
+		CodeChallenge: ar.codeChallenge,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create authorization code", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't authorize app", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditAppAuthorized, userID, userID, "client "+ar.client.ID.String()+" scopes "+ar.scopes)
+	redirectWithAuthorizationResult(rw, req, ar, url.Values{"code": {code}})
+}
+
+// handlerOAuthToken is the RFC 6749 token endpoint. It exchanges an
+// authorization code and its PKCE verifier, or a refresh token, for tokens.
+func (cfg *apiConfig) handlerOAuthToken(rw http.ResponseWriter, req *http.Request) {
+	type response struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope,omitempty"`
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+
+	client, err := cfg.authenticateOAuthClient(req)
+	if err != nil {
+		respondWithOAuthError(rw, http.StatusUnauthorized, "invalid_client", err.Error(), err)
+		return
+	}
+	clientID := uuid.NullUUID{UUID: client.ID, Valid: true}
+
+	switch req.PostFormValue("grant_type") {
+	case "authorization_code":
+		codeHash := auth.HashToken(req.PostFormValue("code"))
+
+		tx, err := cfg.db.BeginTx(req.Context(), nil)
+		if err != nil {
+			respondWithOAuthError(rw, http.StatusInternalServerError, "server_error", "Couldn't check authorization code", err)
+			return
+		}
+		defer tx.Rollback()
+		qtx := cfg.dbQueries.WithTx(tx)
+
+		// the code is only marked used once every check passes, so a client
+		// that got hold of someone else's code can't burn it
+		code, err := qtx.GetOAuthAuthorizationCodeForUpdate(req.Context(), codeHash)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && code.ClientID != client.ID) {
+			respondWithOAuthError(rw, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid, expired or used", err)
+			return
+		}
+		if err != nil {
+			respondWithOAuthError(rw, http.StatusInternalServerError, "server_error", "Couldn't check authorization code", err)
+			return
+		}
+		if code.UsedAt.Valid {
+			// RFC 6749 4.1.2: a replayed code revokes what it was exchanged for
+			if code.FamilyID.Valid {
+				if err := qtx.RevokeRefreshTokenFamily(req.Context(), code.FamilyID.UUID); err != nil {
+					respondWithOAuthError(rw, http.StatusInternalServerError, "server_error", "Couldn't revoke tokens", err)
+					return
+				}
+				if err := cfg.denyFamilyAccessTokens(req.Context(), qtx, code.FamilyID.UUID); err != nil {
+					respondWithOAuthError(rw, http.StatusInternalServerError, "server_error", "Couldn't revoke tokens", err)
+					return
+				}
+				if err := tx.Commit(); err != nil {
+					respondWithOAuthError(rw, http.StatusInternalServerError, "server_error", "Couldn't revoke tokens", err)
+					return
+				}
+				cfg.recordAuditEvent(req, auditAuthCodeReused, uuid.Nil, code.UserID, "client "+client.ID.String()+" session "+code.FamilyID.UUID.String())
+			}
+			respondWithOAuthError(rw, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid, expired or used", nil)
+			return
+		}
+		if !code.ExpiresAt.After(time.Now()) {
+			respondWithOAuthError(rw, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid, expired or used", nil)
+			return
+		}
+		if code.RedirectUri != req.PostFormValue("redirect_uri") {
+			respondWithOAuthError(rw, http.StatusBadRequest, "invalid_grant", "redirect_uri doesn't match the authorization request", nil)
+			return
+		}
+		if !auth.VerifyPKCE(req.PostFormValue("code_verifier"), code.CodeChallenge) {
+			respondWithOAuthError(rw, http.StatusBadRequest, "invalid_grant", "code_verifier doesn't match the code_challenge", nil)
+			return
+		}
+
+		// the user may have revoked the app since approving
+		if _, err := qtx.GetOAuthGrant(req.Context(), database.GetOAuthGrantParams{
+			UserID:   code.UserID,
+			ClientID: client.ID,
+		}); err != nil {
+			respondWithOAuthError(rw, http.StatusBadRequest, "invalid_grant", "The app is no longer authorized", err)
+			return
+		}
+
+		familyID := uuid.New()
+		err = qtx.UseOAuthAuthorizationCode(req.Context(), database.UseOAuthAuthorizationCodeParams{
+			CodeHash: codeHash,
+			FamilyID: uuid.NullUUID{UUID: familyID, Valid: true},
+		})
+		if err != nil {
+			respondWithOAuthError(rw, http.StatusInternalServerError, "server_error", "Couldn't use authorization code", err)
+			return
+		}
+
+		accessToken, err := auth.MakeDelegatedAccessToken(code.UserID, client.ID.String(), code.Scopes, cfg.jwtKeys, oauthAccessTokenExpiry)
+		if err != nil {
+			respondWithOAuthError(rw, http.StatusInternalServerError, "server_error", "Couldn't create access token", err)
+			return
+		}
+		refreshToken, err := createRefreshToken(req, qtx, code.UserID, familyID, clientID, accessToken)
+		if err != nil {
+			respondWithOAuthError(rw, http.StatusInternalServerError, "server_error", "Couldn't create refresh token", err)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			respondWithOAuthError(rw, http.StatusInternalServerError, "server_error", "Couldn't create refresh token", err)
+			return
+		}
+
+		respondWithJSON(rw, http.StatusOK, response{
+			AccessToken:  accessToken.Token,
+			TokenType:    "Bearer",
+			ExpiresIn:    int(oauthAccessTokenExpiry / time.Second),
+			RefreshToken: refreshToken,
+			Scope:        code.Scopes,
+		})
+
+	case "refresh_token":
+		accessToken, refreshToken, err := cfg.rotateSession(req, req.PostFormValue("refresh_token"), clientID)
+		if errors.Is(err, errInvalidRefreshToken) || errors.Is(err, errRefreshTokenReused) {
+			respondWithOAuthError(rw, http.StatusBadRequest, "invalid_grant", err.Error(), err)
+			return
+		}
+		if err != nil {
+			respondWithOAuthError(rw, http.StatusInternalServerError, "server_error", "Couldn't refresh token", err)
+			return
+		}
+
+		respondWithJSON(rw, http.StatusOK, response{
+			AccessToken:  accessToken.Token,
+			TokenType:    "Bearer",
+			ExpiresIn:    int(oauthAccessTokenExpiry / time.Second),
+			RefreshToken: refreshToken,
+		})
+
+	default:
+		respondWithOAuthError(rw, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token", nil)
+	}
+}
+
+// handlerIntrospect implements RFC 7662 for confidential clients. Only
+// clients an admin has marked as resource servers learn about tokens issued
+// to someone else; for everyone else those, like any token that isn't a
+// valid, unrevoked access token, are reported as inactive.
+func (cfg *apiConfig) handlerIntrospect(rw http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		Sub       string `json:"sub,omitempty"`
+		Aud       string `json:"aud,omitempty"`
+		Exp       int64  `json:"exp,omitempty"`
+		Iat       int64  `json:"iat,omitempty"`
+		Jti       string `json:"jti,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+	}
+
+	client, err := cfg.authenticateOAuthClient(req)
+	if err == nil && !client.SecretHash.Valid {
+		err = errors.New("public clients can't introspect tokens")
+	}
+	if err != nil {
+		respondWithOAuthError(rw, http.StatusUnauthorized, "invalid_client", err.Error(), err)
+		return
+	}
+
+	claims, err := auth.ParseAccessToken(req.PostFormValue("token"), cfg.jwtKeys)
+	if err != nil {
+		respondWithJSON(rw, http.StatusOK, response{Active: false})
+		return
+	}
+	if !client.IsResourceServer && claims.ClientID != client.ID.String() {
+		respondWithJSON(rw, http.StatusOK, response{Active: false})
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, response{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Sub:       claims.UserID.String(),
+		Aud:       claims.ClientID,
+		Exp:       claims.ExpiresAt.Unix(),
+		Iat:       claims.IssuedAt.Unix(),
+		Jti:       claims.ID,
+		TokenType: "Bearer",
+	})
+}
+
+// parseAuthorizationRequest reads the authorization request from the query
+// or form. Until the client and redirect_uri check out, problems can't be
+// sent back to the app and are returned as err; after that they come back
+// as an OAuth error code to redirect with.
+func (cfg *apiConfig) parseAuthorizationRequest(req *http.Request) (authorizationRequest, string, error) {
+	ar := authorizationRequest{
+		state:         req.FormValue("state"),
+		codeChallenge: req.FormValue("code_challenge"),
+	}
+
+	clientID, err := uuid.Parse(req.FormValue("client_id"))
+	if err != nil {
+		return ar, "", errors.New("Invalid client_id")
+	}
+	ar.client, err = cfg.dbQueries.GetOAuthClient(req.Context(), clientID)
+	if err != nil {
+		return ar, "", errors.New("Unknown client_id")
+	}
+
+	registered := strings.Fields(ar.client.RedirectUris)
+	ar.redirectURI = req.FormValue("redirect_uri")
+	if ar.redirectURI == "" && len(registered) == 1 {
+		ar.redirectURI = registered[0]
+	}
+	found := false
+	for _, uri := range registered {
+		if uri == ar.redirectURI {
+			found = true
+		}
+	}
+	if !found {
+		return ar, "", errors.New("redirect_uri isn't registered for this client")
+	}
+
+	if req.FormValue("response_type") != "code" {
+		return ar, "unsupported_response_type", nil
+	}
+	// PKCE is required of every client, not just public ones
+	if ar.codeChallenge == "" || req.FormValue("code_challenge_method") != "S256" {
+		return ar, "invalid_request", nil
+	}
+	ar.scopes, err = auth.JoinScopes(strings.Fields(req.FormValue("scope")))
+	if err != nil {
+		return ar, "invalid_scope", nil
+	}
+	return ar, "", nil
+}
+
+// authenticateForConsent resolves the user deciding on an authorization
+// request. It takes first-party logins only, typically a browser session.
+func (cfg *apiConfig) authenticateForConsent(rw http.ResponseWriter, req *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, "Log in to authorize apps", err)
+		return uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, "Log in to authorize apps", err)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// authenticateOAuthClient reads the client credentials from HTTP basic
+// auth or the form. Confidential clients must send their secret; public
+// clients only send their client_id.
+func (cfg *apiConfig) authenticateOAuthClient(req *http.Request) (database.OauthClient, error) {
+	id, secret, ok := req.BasicAuth()
+	if !ok {
+		id = req.PostFormValue("client_id")
+		secret = req.PostFormValue("client_secret")
+	}
+
+	clientID, err := uuid.Parse(id)
+	if err != nil {
+		return database.OauthClient{}, errors.New("Invalid client_id")
+	}
+	client, err := cfg.dbQueries.GetOAuthClient(req.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("Unknown client")
+	}
+
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return database.OauthClient{}, errors.New("Public clients have no secret")
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, errors.New("Invalid client credentials")
+	}
+	return client, nil
+}
+
+func redirectWithAuthorizationResult(rw http.ResponseWriter, req *http.Request, ar authorizationRequest, params url.Values) {
+	u, err := url.Parse(ar.redirectURI)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Invalid redirect_uri", err)
+		return
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if ar.state != "" {
+		query.Set("state", ar.state)
+	}
+	u.RawQuery = query.Encode()
+	http.Redirect(rw, req, u.String(), http.StatusSeeOther)
+}
+
+// respondWithOAuthError uses the RFC 6749 error format, which OAuth client
+// libraries expect from the token and introspection endpoints.
+func respondWithOAuthError(rw http.ResponseWriter, code int, oauthErr, description string, err error) {
+	type response struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err != nil {
+		log.Println(err)
+	}
+	if code >= 500 {
+		log.Printf("Responding with 5XX status code: %s", description)
+	}
+	respondWithJSON(rw, code, response{
+		Error:            oauthErr,
+		ErrorDescription: description,
+	})
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxClientNameLength   = 100
+	maxClientRedirectURIs = 10
+)
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	// ResourceServer clients may introspect tokens issued to any client.
+	ResourceServer bool      `json:"resource_server"`
+	CreatedAt      time.Time `json:"created_at"`
+	// ClientSecret is only set in the response that registers a
+	// confidential client.
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type AuthorizedApp struct {
+	ClientID  uuid.UUID `json:"client_id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// handlerCreateOAuthClient registers an app. Confidential clients get a
+// secret for server-side use; public clients (SPAs, mobile apps) have none
+// and rely on PKCE.
+func (cfg *apiConfig) handlerCreateOAuthClient(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	if !cfg.requireVerifiedEmail(rw, req, userID) {
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > maxClientNameLength {
+		respondWithError(rw, http.StatusBadRequest, "Name must be 1-100 characters", nil)
+		return
+	}
+	if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > maxClientRedirectURIs {
+		respondWithError(rw, http.StatusBadRequest, "Register 1-10 redirect_uris", nil)
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			respondWithError(rw, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if params.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't create client secret", err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.dbQueries.CreateOAuthClient(req.Context(), database.CreateOAuthClientParams{
+		OwnerID:      userID,
+		Name:         name,
+		RedirectUris: strings.Join(params.RedirectURIs, " "),
+		SecretHash:   secretHash,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't register client", err)
+		return
+	}
+
+	resp := databaseClientToOAuthClient(client)
+	resp.ClientSecret = secret
+	respondWithJSON(rw, http.StatusCreated, resp)
+}
+
+func (cfg *apiConfig) handlerGetOAuthClients(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	clients, err := cfg.dbQueries.GetUserOAuthClients(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get clients", err)
+		return
+	}
+
+	clientsResponse := []OAuthClient{}
+	for _, c := range clients {
+		clientsResponse = append(clientsResponse, databaseClientToOAuthClient(c))
+	}
+
+	respondWithJSON(rw, http.StatusOK, clientsResponse)
+}
+
+// handlerDeleteOAuthClient removes an app along with every grant, code and
+// token issued to it.
+func (cfg *apiConfig) handlerDeleteOAuthClient(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	clientID, err := uuid.Parse(req.PathValue("clientID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	client, err := cfg.dbQueries.GetOAuthClient(req.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && client.OwnerID != userID) {
+		respondWithError(rw, http.StatusNotFound, "Couldn't find client", err)
+		return
+	}
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get client", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't delete client", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// deny the access tokens while the refresh tokens recording them exist
+	denied, err := qtx.DenyClientAccessTokens(req.Context(), uuid.NullUUID{UUID: clientID, Valid: true})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke the client's tokens", err)
+		return
+	}
+	for _, d := range denied {
+		cfg.addToDenylist(d.Jti, d.TtlSeconds)
+	}
+	if _, err := qtx.DeleteOAuthClient(req.Context(), database.DeleteOAuthClientParams{
+		ID:      clientID,
+		OwnerID: userID,
+	}); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't delete client", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't delete client", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerGetAuthorizedApps(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	grants, err := cfg.dbQueries.GetUserOAuthGrants(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get authorized apps", err)
+		return
+	}
+
+	apps := []AuthorizedApp{}
+	for _, g := range grants {
+		apps = append(apps, AuthorizedApp{
+			ClientID:  g.ClientID,
+			Name:      g.Name,
+			Scopes:    strings.Fields(g.Scopes),
+			CreatedAt: g.CreatedAt,
+			UpdatedAt: g.UpdatedAt,
+		})
+	}
+
+	respondWithJSON(rw, http.StatusOK, apps)
+}
+
+// handlerRevokeAuthorizedApp withdraws the user's consent for an app and
+// revokes every token it holds for them.
+func (cfg *apiConfig) handlerRevokeAuthorizedApp(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	clientID, err := uuid.Parse(req.PathValue("clientID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke app", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	deleted, err := qtx.DeleteOAuthGrant(req.Context(), database.DeleteOAuthGrantParams{
+		UserID:   userID,
+		ClientID: clientID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke app", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(rw, http.StatusNotFound, "Couldn't find authorized app", nil)
+		return
+	}
+
+	err = qtx.DeleteUserClientAuthorizationCodes(req.Context(), database.DeleteUserClientAuthorizationCodesParams{
+		UserID:   userID,
+		ClientID: clientID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke app", err)
+		return
+	}
+	err = qtx.RevokeUserClientRefreshTokens(req.Context(), database.RevokeUserClientRefreshTokensParams{
+		UserID:   userID,
+		ClientID: uuid.NullUUID{UUID: clientID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke the app's refresh tokens", err)
+		return
+	}
+	denied, err := qtx.DenyUserClientAccessTokens(req.Context(), database.DenyUserClientAccessTokensParams{
+		UserID:   userID,
+		ClientID: uuid.NullUUID{UUID: clientID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke the app's access tokens", err)
+		return
+	}
+	for _, d := range denied {
+		cfg.addToDenylist(d.Jti, d.TtlSeconds)
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke app", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditAppRevoked, userID, userID, "client "+clientID.String())
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+// validateRedirectURI only allows absolute https URIs, or http ones on the
+// loopback interface for local development, without fragments.
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return fmt.Errorf("Invalid redirect_uri %q", uri)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect_uri %q must use https", uri)
+}
+
+func databaseClientToOAuthClient(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:             client.ID,
+		Name:           client.Name,
+		RedirectURIs:   strings.Fields(client.RedirectUris),
+		Confidential:   client.SecretHash.Valid,
+		ResourceServer: client.IsResourceServer,
+		CreatedAt:      client.CreatedAt,
+	}
+}
+
+// handlerSetResourceServer lets an admin allow or stop a confidential
+// client introspecting tokens issued to other clients.
+func (cfg *apiConfig) handlerSetResourceServer(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		ResourceServer bool `json:"resource_server"`
+	}
+
+	clientID, err := uuid.Parse(req.PathValue("clientID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	client, err := cfg.dbQueries.GetOAuthClient(req.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusNotFound, "Couldn't find app", err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get app", err)
+		return
+	}
+	if params.ResourceServer && !client.SecretHash.Valid {
+		respondWithError(rw, http.StatusBadRequest, "Only confidential apps can be resource servers", nil)
+		return
+	}
+
+	client, err = cfg.dbQueries.SetOAuthClientResourceServer(req.Context(), database.SetOAuthClientResourceServerParams{
+		IsResourceServer: params.ResourceServer,
+		ID:               clientID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't update app", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditAdminResourceServer, requestActorID(req), client.OwnerID, fmt.Sprintf("client %s resource server %t", client.ID, client.IsResourceServer))
+
+	respondWithJSON(rw, http.StatusOK, databaseClientToOAuthClient(client))
+}
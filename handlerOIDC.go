@@ -0,0 +1,439 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/bencuci/chirpy/internal/oidc"
+	"github.com/google/uuid"
+)
+
+const (
+	// oidcStateCookie binds a sign-in to the browser that started it, so
+	// a callback URL lured out of one browser is useless in another.
+	oidcStateCookie     = "chirpy_oidc_state"
+	oidcStateCookiePath = "/api/login/oidc"
+	oidcStateExpiry     = 10 * time.Minute
+)
+
+type Identity struct {
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+func (cfg *apiConfig) handlerGetOIDCProviders(rw http.ResponseWriter, req *http.Request) {
+	names := []string{}
+	for name := range cfg.oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	respondWithJSON(rw, http.StatusOK, names)
+}
+
+// handlerOIDCLogin sends the browser to the provider to sign in. The
+// provider sends it back to handlerOIDCCallback.
+func (cfg *apiConfig) handlerOIDCLogin(rw http.ResponseWriter, req *http.Request) {
+	provider, ok := cfg.oidcProvider(rw, req)
+	if !ok {
+		return
+	}
+
+	authURL, err := cfg.startOIDCFlow(rw, req, provider, uuid.NullUUID{})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't start sign-in", err)
+		return
+	}
+
+	http.Redirect(rw, req, authURL, http.StatusFound)
+}
+
+// handlerLinkIdentity starts the same flow for a logged in user. Its
+// callback links the provider account instead of logging in with it.
+func (cfg *apiConfig) handlerLinkIdentity(rw http.ResponseWriter, req *http.Request) {
+	type response struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	provider, ok := cfg.oidcProvider(rw, req)
+	if !ok {
+		return
+	}
+
+	authURL, err := cfg.startOIDCFlow(rw, req, provider, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't start linking", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, response{AuthorizationURL: authURL})
+}
+
+func (cfg *apiConfig) handlerOIDCCallback(rw http.ResponseWriter, req *http.Request) {
+	provider, ok := cfg.oidcProvider(rw, req)
+	if !ok {
+		return
+	}
+
+	// whatever happens next, this sign-in attempt is over
+	http.SetCookie(rw, &http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   oidcStateCookiePath,
+		MaxAge: -1,
+		Secure: true,
+	})
+
+	query := req.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		respondWithError(rw, http.StatusUnauthorized, "Sign-in was cancelled or refused: "+providerErr, nil)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := req.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respondWithError(rw, http.StatusBadRequest, "Sign-in wasn't started from this browser", err)
+		return
+	}
+
+	loginState, err := cfg.dbQueries.UseOIDCLoginState(req.Context(), auth.HashToken(state))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && loginState.Provider != provider.Name()) {
+		respondWithError(rw, http.StatusBadRequest, "Sign-in expired, please try again", err)
+		return
+	}
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check sign-in state", err)
+		return
+	}
+
+	identity, err := provider.Exchange(req.Context(), query.Get("code"), loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, "Couldn't verify the sign-in with "+provider.Name(), err)
+		return
+	}
+
+	if loginState.UserID.Valid {
+		cfg.linkIdentity(rw, req, provider.Name(), loginState.UserID.UUID, identity)
+		return
+	}
+	cfg.loginWithIdentity(rw, req, provider.Name(), identity)
+}
+
+func (cfg *apiConfig) handlerGetIdentities(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	identities, err := cfg.dbQueries.GetUserIdentities(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get linked accounts", err)
+		return
+	}
+
+	identitiesResponse := []Identity{}
+	for _, identity := range identities {
+		identitiesResponse = append(identitiesResponse, databaseIdentityToIdentity(identity))
+	}
+
+	respondWithJSON(rw, http.StatusOK, identitiesResponse)
+}
+
+// handlerUnlinkIdentity removes a linked provider account, as long as the
+// user still has a password or another provider to log in with.
+func (cfg *apiConfig) handlerUnlinkIdentity(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	provider := req.PathValue("provider")
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't unlink account", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	user, err := qtx.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	deleted, err := qtx.DeleteUserIdentity(req.Context(), database.DeleteUserIdentityParams{
+		UserID:   userID,
+		Provider: provider,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't unlink account", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(rw, http.StatusNotFound, "No linked account for "+provider, nil)
+		return
+	}
+
+	remaining, err := qtx.CountUserIdentities(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't unlink account", err)
+		return
+	}
+	if remaining == 0 && !user.HashedPassword.Valid {
+		respondWithError(rw, http.StatusConflict, "Set a password or link another provider before unlinking your last way to log in", nil)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't unlink account", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditIdentityUnlinked, userID, userID, provider)
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+// startOIDCFlow records a sign-in attempt and returns the provider URL to
+// send the browser to. The state, nonce and PKCE verifier are all fresh
+// per attempt; only the state ever reaches the browser.
+func (cfg *apiConfig) startOIDCFlow(rw http.ResponseWriter, req *http.Request, provider *oidc.Provider, linkUserID uuid.NullUUID) (string, error) {
+	state, err1 := auth.MakeRefreshToken()
+	nonce, err2 := auth.MakeRefreshToken()
+	verifier, err3 := auth.MakeRefreshToken()
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(req.Context(), state, nonce, auth.PKCEChallenge(verifier))
+	if err != nil {
+		return "", err
+	}
+
+	if err := cfg.dbQueries.DeleteExpiredOIDCLoginStates(req.Context()); err != nil {
+		log.Printf("Couldn't delete expired sign-in states: %v", err)
+	}
+	err = cfg.dbQueries.CreateOIDCLoginState(req.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashToken(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       linkUserID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Lax, because the provider's redirect back to us is a cross-site
+	// navigation
+	http.SetCookie(rw, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcStateCookiePath,
+		MaxAge:   int(oidcStateExpiry / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return authURL, nil
+}
+
+func (cfg *apiConfig) linkIdentity(rw http.ResponseWriter, req *http.Request, provider string, userID uuid.UUID, identity oidc.Identity) {
+	existing, err := cfg.dbQueries.GetUserIdentity(req.Context(), database.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		msg := fmt.Sprintf("This %s account is already linked to another Chirpy account", provider)
+		if existing.UserID == userID {
+			msg = fmt.Sprintf("This %s account is already linked", provider)
+		}
+		respondWithError(rw, http.StatusConflict, msg, nil)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check linked accounts", err)
+		return
+	}
+
+	created, err := cfg.dbQueries.CreateUserIdentity(req.Context(), database.CreateUserIdentityParams{
+		Provider: provider,
+		Subject:  identity.Subject,
+		UserID:   userID,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(rw, http.StatusConflict, fmt.Sprintf("You already linked a different %s account, unlink it first", provider), err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't link account", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditIdentityLinked, userID, userID, provider)
+	respondWithJSON(rw, http.StatusCreated, databaseIdentityToIdentity(created))
+}
+
+// loginWithIdentity logs in the user a provider account is linked to,
+// creating a password-less account on its first sign-in. Browser sign-ins
+// always get cookie sessions.
+func (cfg *apiConfig) loginWithIdentity(rw http.ResponseWriter, req *http.Request, provider string, identity oidc.Identity) {
+	var user database.User
+	existing, err := cfg.dbQueries.GetUserIdentity(req.Context(), database.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  identity.Subject,
+	})
+	switch {
+	case err == nil:
+		err = cfg.dbQueries.TouchUserIdentity(req.Context(), database.TouchUserIdentityParams{
+			Email:    identity.Email,
+			Provider: provider,
+			Subject:  identity.Subject,
+		})
+		if err != nil {
+			log.Printf("Couldn't update linked account: %v", err)
+		}
+		user, err = cfg.dbQueries.GetUserByID(req.Context(), existing.UserID)
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+			return
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		var ok bool
+		user, ok = cfg.createUserFromIdentity(rw, req, provider, identity)
+		if !ok {
+			return
+		}
+	default:
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check linked accounts", err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithTwoFactorChallenge(rw, user)
+		return
+	}
+	cfg.respondWithSession(rw, req, user, 0, true)
+}
+
+// createUserFromIdentity registers a new account for a provider account.
+// It needs an address the provider has verified, and never attaches to an
+// existing Chirpy account by email, since whoever controls the provider
+// account would get that account too.
+func (cfg *apiConfig) createUserFromIdentity(rw http.ResponseWriter, req *http.Request, provider string, identity oidc.Identity) (database.User, bool) {
+	if cfg.inviteOnly {
+		respondWithError(rw, http.StatusForbidden, fmt.Sprintf("Registration is invite-only, sign up with an invite code and link %s afterwards", provider), nil)
+		return database.User{}, false
+	}
+	if identity.Email == "" || !identity.EmailVerified {
+		respondWithError(rw, http.StatusForbidden, provider+" didn't share a verified email address", nil)
+		return database.User{}, false
+	}
+
+	alreadyRegistered := fmt.Sprintf("An account with this email already exists, log in and link %s from your account instead", provider)
+	if _, err := cfg.dbQueries.GetUser(req.Context(), identity.Email); err == nil {
+		respondWithError(rw, http.StatusConflict, alreadyRegistered, nil)
+		return database.User{}, false
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return database.User{}, false
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not create user", err)
+		return database.User{}, false
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	user, err := qtx.CreateUser(req.Context(), database.CreateUserParams{
+		Email:          identity.Email,
+		HashedPassword: sql.NullString{},
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(rw, http.StatusConflict, alreadyRegistered, err)
+			return database.User{}, false
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Could not create user", err)
+		return database.User{}, false
+	}
+	// the provider already verified the address
+	user, err = qtx.VerifyUserEmail(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not create user", err)
+		return database.User{}, false
+	}
+	_, err = qtx.CreateUserIdentity(req.Context(), database.CreateUserIdentityParams{
+		Provider: provider,
+		Subject:  identity.Subject,
+		UserID:   user.ID,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't link account", err)
+		return database.User{}, false
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not create user", err)
+		return database.User{}, false
+	}
+
+	cfg.recordAuditEvent(req, auditIdentityLinked, user.ID, user.ID, provider+" (new account)")
+	return user, true
+}
+
+func (cfg *apiConfig) oidcProvider(rw http.ResponseWriter, req *http.Request) (*oidc.Provider, bool) {
+	provider, ok := cfg.oidcProviders[req.PathValue("provider")]
+	if !ok {
+		respondWithError(rw, http.StatusNotFound, "Unknown identity provider", nil)
+	}
+	return provider, ok
+}
+
+func databaseIdentityToIdentity(identity database.UserIdentity) Identity {
+	resp := Identity{
+		Provider:  identity.Provider,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	}
+	if identity.LastLoginAt.Valid {
+		resp.LastLoginAt = &identity.LastLoginAt.Time
+	}
+	return resp
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/bencuci/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	passwordResetEmailTimeout = 30 * time.Second
+	// passwordResetMaxRequests resets can be asked for per email every 15
+	// minutes
+	passwordResetMaxRequests = 3
+)
+
+func (cfg *apiConfig) handlerForgotPassword(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	type response struct {
+		Message string `json:"message"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	email := normalizeLoginEmail(params.Email)
+	if email == "" {
+		respondWithError(rw, http.StatusBadRequest, "Email is required", nil)
+		return
+	}
+
+	// like login links, the limit applies whether or not the account
+	// exists, and parallel requests for an email take turns
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check the rate limit", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	if err := qtx.LockPasswordResetRequests(req.Context(), email); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check the rate limit", err)
+		return
+	}
+	retryAfter, err := qtx.GetPasswordResetRetrySeconds(req.Context(), database.GetPasswordResetRetrySecondsParams{
+		MaxRequests: passwordResetMaxRequests,
+		Email:       email,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check the rate limit", err)
+		return
+	}
+	if retryAfter > 0 {
+		rw.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+		respondWithError(rw, http.StatusTooManyRequests, "Too many password resets requested, try again later", nil)
+		return
+	}
+	if err := qtx.CreatePasswordResetRequest(req.Context(), email); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't record the request", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't record the request", err)
+		return
+	}
+	if err := cfg.dbQueries.DeleteOldPasswordResetRequests(req.Context()); err != nil {
+		log.Printf("Couldn't delete old password reset requests: %v", err)
+	}
+
+	// The email is sent in the background and the response is the same
+	// whether or not the account exists, so neither the body nor the
+	// timing reveals registered addresses.
+	go func(email string) {
+		ctx, cancel := context.WithTimeout(context.Background(), passwordResetEmailTimeout)
+		defer cancel()
+		if err := cfg.sendPasswordResetEmail(ctx, email); err != nil {
+			log.Printf("Couldn't send password reset email: %v", err)
+		}
+	}(params.Email)
+
+	respondWithJSON(rw, http.StatusAccepted, response{
+		Message: "If an account with that email exists, a reset link has been sent.",
+	})
+}
+
+func (cfg *apiConfig) handlerResetPassword(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	userID, err := qtx.UsePasswordResetToken(req.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusBadRequest, "Invalid or expired reset token", err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	// the policy needs the email, and a rejected password rolls back so the token stays usable
+	user, err := qtx.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	if !cfg.checkPasswordPolicy(rw, params.Password, user.Email) {
+		return
+	}
+
+	hashedPW, err := cfg.passwordHasher.Hash(params.Password)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't hash the password", err)
+		return
+	}
+
+	err = qtx.UpdateUserPassword(req.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: sql.NullString{String: hashedPW, Valid: true},
+		ID:             userID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	// other outstanding reset links, every existing session and every personal
+	// access token die with the old password
+	if err := qtx.DeletePasswordResetTokens(req.Context(), userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	if err := qtx.RevokeUserRefreshTokens(req.Context(), userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke refresh tokens", err)
+		return
+	}
+	if err := cfg.denyUserAccessTokens(req.Context(), qtx, userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+		return
+	}
+	if err := qtx.RevokeUserPersonalAccessTokens(req.Context(), userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke personal access tokens", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditPasswordReset, uuid.Nil, userID, "")
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, email string) error {
+	user, err := cfg.dbQueries.GetUser(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.dbQueries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't store reset token: %w", err)
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset your Chirpy password. If it was you, send this token with your new password to POST /api/password/reset:\n\n%s\n\nIt expires in 1 hour. If it wasn't you, you can ignore this email.",
+			token,
+		),
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	handleRenameCooldown = 30 * 24 * time.Hour
+)
+
+var handleRegexp = regexp.MustCompile(`^[A-Za-z0-9_]{3,15}$`)
+
+// reservedHandles can't be claimed because they collide with routes or
+// could be used to impersonate the service.
+var reservedHandles = map[string]struct{}{
+	"admin": {}, "administrator": {}, "api": {}, "app": {}, "chirpy": {},
+	"help": {}, "login": {}, "logout": {}, "me": {}, "mod": {},
+	"moderator": {}, "null": {}, "root": {}, "settings": {}, "staff": {},
+	"support": {}, "system": {}, "undefined": {},
+}
+
+type Profile struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	IsProtected bool      `json:"is_protected"`
+}
+
+func (cfg *apiConfig) handlerGetUserProfile(rw http.ResponseWriter, req *http.Request) {
+	idOrHandle := req.PathValue("idOrHandle")
+
+	var err error
+	var user database.User
+	if id, parseErr := uuid.Parse(idOrHandle); parseErr == nil {
+		user, err = cfg.dbQueries.GetUserByID(req.Context(), id)
+	} else {
+		user, err = cfg.dbQueries.GetUserByHandle(req.Context(), strings.TrimPrefix(idOrHandle, "@"))
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusNotFound, "user not found", err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, Profile{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		Handle:      user.Handle.String,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		IsChirpyRed: user.IsChirpyRed,
+		IsProtected: user.IsProtected,
+	})
+}
+
+func validateHandle(handle string) error {
+	if !handleRegexp.MatchString(handle) {
+		return errors.New("Handle must be 3-15 letters, digits or underscores")
+	}
+	if _, reserved := reservedHandles[strings.ToLower(handle)]; reserved {
+		return errors.New("Handle is reserved")
+	}
+
+	return nil
+}
+
+func validateProfile(displayName, bio, avatarURL string) error {
+	if len(displayName) > maxDisplayNameLength {
+		return errors.New("Display name is too long")
+	}
+	if len(bio) > maxBioLength {
+		return errors.New("Bio is too long")
+	}
+	if avatarURL != "" {
+		u, err := url.Parse(avatarURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.New("Avatar URL must be an http(s) URL")
+		}
+	}
+
+	return nil
+}
+
+// isUniqueViolation reports whether err comes from a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"net/http"
+
+	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerResetVisiterCount(rw http.ResponseWriter, req *http.Request) {
@@ -16,6 +18,7 @@ func (cfg *apiConfig) handlerResetVisiterCount(rw http.ResponseWriter, req *http
 		return
 	}
 	cfg.fileserverHits.Store(0)
+	cfg.recordAuditEvent(req, auditAdminReset, requestActorID(req), uuid.Nil, "")
 	rw.WriteHeader(http.StatusOK)
 	rw.Write([]byte("Database has been reset."))
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// middlewareRequireRole only lets requests through whose access token
+// carries at least the required role. Roles come from the token, which is
+// why handlerSetUserRole revokes a demoted user's tokens.
+func (cfg *apiConfig) middlewareRequireRole(required auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+			return
+		}
+		userID, role, err := auth.ValidateJWTRole(token, cfg.jwtKeys)
+		if err != nil {
+			respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+			return
+		}
+		if !role.Includes(required) {
+			respondWithError(rw, http.StatusForbidden, "Forbidden access", nil)
+			return
+		}
+
+		next(rw, req.WithContext(context.WithValue(req.Context(), actorIDKey, userID)))
+	}
+}
+
+func (cfg *apiConfig) handlerSetUserRole(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	role, err := auth.ParseRole(params.Role)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Role must be user, moderator or admin", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't update role", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	current, err := qtx.GetUserByIDForUpdate(req.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusNotFound, "Couldn't find user", err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	user, err := qtx.SetUserRole(req.Context(), database.SetUserRoleParams{
+		Role: string(role),
+		ID:   userID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't update role", err)
+		return
+	}
+
+	// access tokens still carry the old role, so a demoted user is logged
+	// out everywhere rather than keeping it until they expire
+	demoted := !role.Includes(auth.Role(current.Role))
+	if demoted {
+		if err := qtx.RevokeUserRefreshTokens(req.Context(), userID); err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke refresh tokens", err)
+			return
+		}
+		if err := cfg.denyUserAccessTokens(req.Context(), qtx, userID); err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke access tokens", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't update role", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditAdminRoleChanged, requestActorID(req), userID, fmt.Sprintf("role %s to %s", current.Role, role))
+
+	respondWithJSON(rw, http.StatusOK, databaseUserToUser(user))
+}
+
+// bootstrapAdmin makes the account with the given email an admin, but only
+// while there is no admin yet. Every later admin is appointed by an
+// existing one through PUT /admin/users/{userID}/role.
+func bootstrapAdmin(ctx context.Context, db *sql.DB, email string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := database.New(tx)
+
+	admins, err := qtx.CountAdmins(ctx)
+	if err != nil {
+		return err
+	}
+	if admins > 0 {
+		return errors.New("an admin already exists")
+	}
+
+	user, err := qtx.GetUser(ctx, email)
+	if err != nil {
+		return fmt.Errorf("couldn't find user %s: %w", email, err)
+	}
+
+	_, err = qtx.SetUserRole(ctx, database.SetUserRoleParams{
+		Role: string(auth.RoleAdmin),
+		ID:   user.ID,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxUserAgentLength   = 512
+	denylistSyncInterval = 30 * time.Second
+)
+
+// Session is one login, i.e. one refresh token family. Its ID stays the
+// same while the refresh token inside it rotates.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func (cfg *apiConfig) handlerGetSessions(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	sessions, err := cfg.dbQueries.GetUserSessions(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get sessions", err)
+		return
+	}
+
+	sessionsResponse := []Session{}
+	for _, s := range sessions {
+		sessionsResponse = append(sessionsResponse, databaseSessionToSession(s))
+	}
+
+	respondWithJSON(rw, http.StatusOK, sessionsResponse)
+}
+
+func (cfg *apiConfig) handlerRevokeSession(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	sessionID, err := uuid.Parse(req.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	revoked, err := cfg.dbQueries.RevokeUserRefreshTokenFamily(req.Context(), database.RevokeUserRefreshTokenFamilyParams{
+		UserID:   userID,
+		FamilyID: sessionID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(rw, http.StatusNotFound, "Couldn't find session", nil)
+		return
+	}
+	if err := cfg.denyFamilyAccessTokens(req.Context(), cfg.dbQueries, sessionID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditSessionRevoked, userID, userID, "session "+sessionID.String())
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+// handlerRevokeAllSessions logs the user out everywhere, including the
+// session making the request.
+func (cfg *apiConfig) handlerRevokeAllSessions(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	if err := cfg.dbQueries.RevokeUserRefreshTokens(req.Context(), userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	if err := cfg.denyUserAccessTokens(req.Context(), cfg.dbQueries, userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditAllSessionsRevoked, userID, userID, "")
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+// denyFamilyAccessTokens puts the unexpired access tokens issued to a
+// session on the denylist. They are added to the in-process cache right
+// away; if the caller's transaction then rolls back they stay denied here
+// until they expire, which errs on the safe side.
+func (cfg *apiConfig) denyFamilyAccessTokens(ctx context.Context, q *database.Queries, familyID uuid.UUID) error {
+	denied, err := q.DenyFamilyAccessTokens(ctx, familyID)
+	if err != nil {
+		return err
+	}
+	for _, d := range denied {
+		cfg.addToDenylist(d.Jti, d.TtlSeconds)
+	}
+	return nil
+}
+
+// denyUserAccessTokens is denyFamilyAccessTokens for every session the
+// user has.
+func (cfg *apiConfig) denyUserAccessTokens(ctx context.Context, q *database.Queries, userID uuid.UUID) error {
+	denied, err := q.DenyUserAccessTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, d := range denied {
+		cfg.addToDenylist(d.Jti, d.TtlSeconds)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) addToDenylist(jti string, ttlSeconds int32) {
+	cfg.denylist.Add(jti, time.Now().Add(time.Duration(ttlSeconds)*time.Second))
+}
+
+// runDenylistSync keeps the in-process denylist in step with tokens
+// revoked by other instances and clears out entries past their expiry.
+func (cfg *apiConfig) runDenylistSync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := cfg.syncDenylist(ctx); err != nil {
+			log.Printf("Couldn't sync the token denylist: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) syncDenylist(ctx context.Context) error {
+	if err := cfg.dbQueries.DeleteExpiredDeniedTokens(ctx); err != nil {
+		return err
+	}
+
+	denied, err := cfg.dbQueries.GetDeniedTokens(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range denied {
+		cfg.addToDenylist(d.Jti, d.TtlSeconds)
+	}
+	cfg.denylist.Prune()
+	return nil
+}
+
+// clientIP is the address of the peer the request came from. Chirpy is
+// expected to face clients directly, so forwarding headers aren't trusted.
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func requestUserAgent(req *http.Request) string {
+	userAgent := req.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return userAgent
+}
+
+func databaseSessionToSession(session database.GetUserSessionsRow) Session {
+	return Session{
+		ID:         session.FamilyID,
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IpAddress,
+		CreatedAt:  session.StartedAt,
+		LastUsedAt: session.LastUsedAt,
+		ExpiresAt:  session.ExpiresAt,
+	}
+}
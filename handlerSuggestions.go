@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	suggestionsInterval   = 1 * time.Hour
+	suggestionsRecentDays = 30
+	suggestionsPerUser    = 20
+	// suggestionsMaxTagUsers is how many of a hashtag's latest users are
+	// paired up with each other
+	suggestionsMaxTagUsers = 50
+	suggestionsMaxMentions = 5
+)
+
+var hashtagRegexp = regexp.MustCompile(`#(\w+)`)
+
+type Suggestion struct {
+	UserID uuid.UUID `json:"user_id"`
+	Reason string    `json:"reason"`
+}
+
+func (cfg *apiConfig) handlerGetSuggestions(rw http.ResponseWriter, req *http.Request) {
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersRead)
+	if !ok {
+		return
+	}
+
+	suggestions, err := cfg.dbQueries.GetUserSuggestions(req.Context(), database.GetUserSuggestionsParams{
+		UserID: userID,
+		Limit:  suggestionsPerUser,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get suggestions", err)
+		return
+	}
+
+	suggestionsResponse := []Suggestion{}
+	for _, s := range suggestions {
+		suggestionsResponse = append(suggestionsResponse, Suggestion{
+			UserID: s.SuggestedUserID,
+			Reason: s.Reason,
+		})
+	}
+
+	respondWithJSON(rw, http.StatusOK, suggestionsResponse)
+}
+
+// runSuggestionsJob recomputes who-to-follow suggestions on startup and then
+// every interval until ctx is cancelled.
+func (cfg *apiConfig) runSuggestionsJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := cfg.computeSuggestions(ctx); err != nil {
+			log.Printf("Couldn't compute suggestions: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type suggestionCandidate struct {
+	mutualCount int64
+	// mentions of the user by the candidate, and of the candidate by the user
+	mentionedByThem int64
+	mentionedByUser int64
+	sharedTags      []string
+}
+
+func (cfg *apiConfig) computeSuggestions(ctx context.Context) error {
+	type pair struct {
+		userID          uuid.UUID
+		suggestedUserID uuid.UUID
+	}
+	candidates := map[pair]*suggestionCandidate{}
+	candidate := func(p pair) *suggestionCandidate {
+		c, exists := candidates[p]
+		if !exists {
+			c = &suggestionCandidate{}
+			candidates[p] = c
+		}
+		return c
+	}
+	since := time.Now().UTC().AddDate(0, 0, -suggestionsRecentDays)
+
+	friendsOfFriends, err := cfg.dbQueries.GetFriendOfFriendCounts(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get friends of friends: %w", err)
+	}
+	for _, f := range friendsOfFriends {
+		candidate(pair{f.UserID, f.SuggestedUserID}).mutualCount = f.MutualCount
+	}
+
+	// recent engagement is @mentions in public chirps, either way round
+	mentions, err := cfg.dbQueries.GetRecentMentionCounts(ctx, since)
+	if err != nil {
+		return fmt.Errorf("couldn't get recent mentions: %w", err)
+	}
+	for _, m := range mentions {
+		candidate(pair{m.AuthorID, m.MentionedID}).mentionedByUser = m.MentionCount
+		candidate(pair{m.MentionedID, m.AuthorID}).mentionedByThem = m.MentionCount
+	}
+
+	// protected accounts are left out so their hashtags don't show up in
+	// reasons given to people who can't see their chirps
+	chirps, err := cfg.dbQueries.GetPublicChirpsSince(ctx, since)
+	if err != nil {
+		return fmt.Errorf("couldn't get recent chirps: %w", err)
+	}
+	// only the latest few users of each tag are paired up, so a popular tag
+	// doesn't turn into millions of pairs
+	usersByTag := map[string][]uuid.UUID{}
+	seenByTag := map[string]map[uuid.UUID]struct{}{}
+	for _, c := range chirps {
+		for _, tag := range getHashtags(c.Body) {
+			if len(usersByTag[tag]) >= suggestionsMaxTagUsers {
+				continue
+			}
+			if seenByTag[tag] == nil {
+				seenByTag[tag] = map[uuid.UUID]struct{}{}
+			}
+			if _, seen := seenByTag[tag][c.UserID]; seen {
+				continue
+			}
+			seenByTag[tag][c.UserID] = struct{}{}
+			usersByTag[tag] = append(usersByTag[tag], c.UserID)
+		}
+	}
+	for tag, users := range usersByTag {
+		for _, a := range users {
+			for _, b := range users {
+				if a != b {
+					c := candidate(pair{a, b})
+					c.sharedTags = append(c.sharedTags, tag)
+				}
+			}
+		}
+	}
+
+	// already followed, blocked either way and muted accounts are never
+	// suggested
+	exclusions, err := cfg.dbQueries.GetSuggestionExclusions(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get excluded users: %w", err)
+	}
+	excluded := map[pair]struct{}{}
+	for _, e := range exclusions {
+		excluded[pair{e.UserID, e.ExcludedUserID}] = struct{}{}
+	}
+
+	byUser := map[uuid.UUID][]pair{}
+	for p := range candidates {
+		if _, skip := excluded[p]; skip {
+			continue
+		}
+		byUser[p.userID] = append(byUser[p.userID], p)
+	}
+
+	params := database.CreateUserSuggestionsParams{}
+	for _, pairs := range byUser {
+		sort.Slice(pairs, func(i, j int) bool {
+			return candidates[pairs[i]].score() > candidates[pairs[j]].score()
+		})
+		for _, p := range pairs[:min(len(pairs), suggestionsPerUser)] {
+			c := candidates[p]
+			params.UserIds = append(params.UserIds, p.userID)
+			params.SuggestedUserIds = append(params.SuggestedUserIds, p.suggestedUserID)
+			params.Scores = append(params.Scores, c.score())
+			params.Reasons = append(params.Reasons, c.reason())
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	if err := qtx.DeleteUserSuggestions(ctx); err != nil {
+		return fmt.Errorf("couldn't clear suggestions: %w", err)
+	}
+	if err := qtx.CreateUserSuggestions(ctx, params); err != nil {
+		return fmt.Errorf("couldn't store suggestions: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// score weighs a mutual follow higher than a shared hashtag. Mentions
+// count up to suggestionsMaxMentions each way, so spamming someone's
+// handle doesn't put you at the top of their list.
+func (c *suggestionCandidate) score() int32 {
+	engagement := min(c.mentionedByThem, suggestionsMaxMentions) + min(c.mentionedByUser, suggestionsMaxMentions)
+	return int32(c.mutualCount*2+engagement) + int32(len(c.sharedTags))
+}
+
+func (c *suggestionCandidate) reason() string {
+	if c.mutualCount == 1 {
+		return "followed by 1 person you follow"
+	}
+	if c.mutualCount > 1 {
+		return fmt.Sprintf("followed by %d people you follow", c.mutualCount)
+	}
+	if c.mentionedByThem > 0 {
+		return "mentioned you recently"
+	}
+	if c.mentionedByUser > 0 {
+		return "you mentioned them recently"
+	}
+
+	sort.Strings(c.sharedTags)
+	if len(c.sharedTags) == 1 {
+		return fmt.Sprintf("also chirps about #%s", c.sharedTags[0])
+	}
+	return fmt.Sprintf("also chirps about #%s and %d more", c.sharedTags[0], len(c.sharedTags)-1)
+}
+
+func getHashtags(body string) []string {
+	tags := []string{}
+	seen := map[string]struct{}{}
+	for _, match := range hashtagRegexp.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(match[1])
+		if _, exists := seen[tag]; exists {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
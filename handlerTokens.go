@@ -0,0 +1,248 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxTokenNameLength = 100
+
+var (
+	errInvalidPersonalAccessToken = errors.New("invalid or expired personal access token")
+	errInsufficientScope          = errors.New("token doesn't grant the required scope")
+)
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	// Token is only set in the response that creates it.
+	Token string `json:"token,omitempty"`
+}
+
+func (cfg *apiConfig) handlerCreatePersonalAccessToken(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	// JWT only, a personal access token can't mint more of itself
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > maxTokenNameLength {
+		respondWithError(rw, http.StatusBadRequest, "Name must be 1-100 characters", nil)
+		return
+	}
+	scopes, err := auth.JoinScopes(params.Scopes)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if params.ExpiresInDays < 0 {
+		respondWithError(rw, http.StatusBadRequest, "expires_in_days can't be negative", nil)
+		return
+	}
+
+	pat, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	created, err := cfg.dbQueries.CreatePersonalAccessToken(req.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: auth.HashToken(pat),
+		Scopes:    scopes,
+		// 0 means the token never expires
+		ExpiresInDays: sql.NullInt32{Int32: int32(params.ExpiresInDays), Valid: params.ExpiresInDays > 0},
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditAccessTokenCreated, userID, userID, "token "+created.ID.String())
+
+	resp := databaseTokenToPersonalAccessToken(created)
+	resp.Token = pat
+	respondWithJSON(rw, http.StatusCreated, resp)
+}
+
+func (cfg *apiConfig) handlerGetPersonalAccessTokens(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	tokens, err := cfg.dbQueries.GetUserPersonalAccessTokens(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get tokens", err)
+		return
+	}
+
+	tokensResponse := []PersonalAccessToken{}
+	for _, t := range tokens {
+		tokensResponse = append(tokensResponse, databaseTokenToPersonalAccessToken(t))
+	}
+
+	respondWithJSON(rw, http.StatusOK, tokensResponse)
+}
+
+func (cfg *apiConfig) handlerRevokePersonalAccessToken(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	tokenID, err := uuid.Parse(req.PathValue("tokenID"))
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid token ID", err)
+		return
+	}
+
+	revoked, err := cfg.dbQueries.RevokePersonalAccessToken(req.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke token", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(rw, http.StatusNotFound, "Couldn't find token", nil)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditAccessTokenRevoked, userID, userID, "token "+tokenID.String())
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+// authenticate resolves the user behind the request's bearer token, which
+// may be an access JWT or a personal access token granting scope. It
+// responds with 401, or 403 for a token lacking the scope, and returns
+// false when the request isn't allowed.
+func (cfg *apiConfig) authenticate(rw http.ResponseWriter, req *http.Request, scope string) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return uuid.Nil, false
+	}
+
+	userID, err := cfg.validateBearerToken(req, token, scope)
+	if errors.Is(err, errInsufficientScope) {
+		respondWithError(rw, http.StatusForbidden, err.Error(), err)
+		return uuid.Nil, false
+	}
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// getViewerID returns the ID of the user making a request on a public
+// endpoint, or uuid.Nil if the request is anonymous. A missing, expired or
+// otherwise unusable token counts as anonymous, so public reads keep
+// working for clients holding a stale token.
+func (cfg *apiConfig) getViewerID(req *http.Request) uuid.UUID {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return uuid.Nil
+	}
+
+	viewerID, err := cfg.validateBearerToken(req, token, auth.ScopeChirpsRead)
+	if err != nil {
+		return uuid.Nil
+	}
+	return viewerID
+}
+
+func (cfg *apiConfig) validateBearerToken(req *http.Request, token, scope string) (uuid.UUID, error) {
+	if !auth.IsPersonalAccessToken(token) {
+		claims, err := auth.ParseAccessToken(token, cfg.jwtKeys)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		// tokens issued to OAuth apps carry the scopes the user consented to
+		if claims.ClientID != "" && !auth.HasScope(claims.Scope, scope) {
+			return uuid.Nil, errInsufficientScope
+		}
+		return claims.UserID, nil
+	}
+
+	pat, err := cfg.dbQueries.GetActivePersonalAccessToken(req.Context(), auth.HashToken(token))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Couldn't look up personal access token: %v", err)
+		}
+		return uuid.Nil, errInvalidPersonalAccessToken
+	}
+	if !auth.HasScope(pat.Scopes, scope) {
+		return uuid.Nil, errInsufficientScope
+	}
+
+	if err := cfg.dbQueries.TouchPersonalAccessToken(req.Context(), pat.ID); err != nil {
+		log.Printf("Couldn't update personal access token last use: %v", err)
+	}
+	return pat.UserID, nil
+}
+
+func databaseTokenToPersonalAccessToken(token database.PersonalAccessToken) PersonalAccessToken {
+	pat := PersonalAccessToken{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    strings.Fields(token.Scopes),
+		CreatedAt: token.CreatedAt,
+	}
+	if token.ExpiresAt.Valid {
+		pat.ExpiresAt = &token.ExpiresAt.Time
+	}
+	if token.LastUsedAt.Valid {
+		pat.LastUsedAt = &token.LastUsedAt.Time
+	}
+	return pat
+}
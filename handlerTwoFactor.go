@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer        = "Chirpy"
+	recoveryCodeCount = 10
+)
+
+func (cfg *apiConfig) handlerEnrollTOTP(rw http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(rw, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't generate TOTP secret", err)
+		return
+	}
+
+	// the secret stays pending until a code from it is confirmed
+	_, err = cfg.dbQueries.SetUserTotpSecret(req.Context(), database.SetUserTotpSecretParams{
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+		ID:         userID,
+	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't store TOTP secret", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusCreated, response{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+func (cfg *apiConfig) handlerConfirmTOTP(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(rw, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(rw, http.StatusBadRequest, "Start TOTP enrollment first", nil)
+		return
+	}
+
+	ok, err := cfg.useTOTPCode(req.Context(), user, params.Code)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check TOTP code", err)
+		return
+	}
+	if !ok {
+		respondWithError(rw, http.StatusUnauthorized, "Invalid TOTP code", nil)
+		return
+	}
+
+	recoveryCodes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't generate recovery codes", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	if _, err := qtx.EnableUserTotp(req.Context(), userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+	if err := qtx.DeleteRecoveryCodes(req.Context(), userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't store recovery codes", err)
+		return
+	}
+	for _, code := range recoveryCodes {
+		err := qtx.CreateRecoveryCode(req.Context(), database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashToken(code),
+		})
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't store recovery codes", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditTwoFactorEnabled, userID, userID, "")
+	// recovery codes are only ever shown here
+	respondWithJSON(rw, http.StatusOK, response{RecoveryCodes: recoveryCodes})
+}
+
+func (cfg *apiConfig) handlerDisableTOTP(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(rw, http.StatusBadRequest, "Two-factor authentication is not enabled", nil)
+		return
+	}
+
+	// a stolen access token alone mustn't be enough to turn 2FA off
+	ok, err := cfg.useSecondFactor(req.Context(), user, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check second factor", err)
+		return
+	}
+	if !ok {
+		respondWithError(rw, http.StatusUnauthorized, "Invalid TOTP or recovery code", nil)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	if _, err := qtx.DisableUserTotp(req.Context(), userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+	if err := qtx.DeleteRecoveryCodes(req.Context(), userID); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't delete recovery codes", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	cfg.recordAuditEvent(req, auditTwoFactorDisabled, userID, userID, "")
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+func (cfg *apiConfig) handlerLoginTwoFactor(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		ChallengeToken   string `json:"challenge_token"`
+		Code             string `json:"code"`
+		RecoveryCode     string `json:"recovery_code"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+		UseCookies       bool   `json:"use_cookies"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	userID, err := auth.ValidateChallengeJWT(params.ChallengeToken, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, "Invalid or expired challenge token", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, "Invalid or expired challenge token", err)
+		return
+	}
+
+	// second factor guesses count against the same lockout as passwords
+	email := normalizeLoginEmail(user.Email)
+	if !cfg.checkLoginLockout(rw, req, email) {
+		return
+	}
+
+	ok, err := cfg.useSecondFactor(req.Context(), user, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check second factor", err)
+		return
+	}
+	if !ok {
+		cfg.recordLoginFailure(req, email)
+		cfg.recordAuditEvent(req, auditLoginFailed, uuid.Nil, user.ID, "wrong second factor")
+		respondWithError(rw, http.StatusUnauthorized, "Invalid TOTP or recovery code", nil)
+		return
+	}
+
+	cfg.clearLoginFailures(req.Context(), email)
+	cfg.respondWithSession(rw, req, user, params.ExpiresInSeconds, params.UseCookies)
+}
+
+// useSecondFactor accepts either a TOTP code or an unused recovery code
+// and burns whichever was used.
+func (cfg *apiConfig) useSecondFactor(ctx context.Context, user database.User, code, recoveryCode string) (bool, error) {
+	if !user.TotpEnabledAt.Valid {
+		return false, nil
+	}
+
+	if recoveryCode != "" {
+		used, err := cfg.dbQueries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashToken(strings.ToLower(strings.TrimSpace(recoveryCode))),
+		})
+		if err != nil {
+			return false, err
+		}
+		return used == 1, nil
+	}
+
+	return cfg.useTOTPCode(ctx, user, code)
+}
+
+// useTOTPCode validates a code against the user's secret and records its
+// time step so the same code can't be replayed.
+func (cfg *apiConfig) useTOTPCode(ctx context.Context, user database.User, code string) (bool, error) {
+	if !user.TotpSecret.Valid {
+		return false, nil
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	updated, err := cfg.dbQueries.UpdateUserTotpLastStep(ctx, database.UpdateUserTotpLastStepParams{
+		TotpLastStep: step,
+		ID:           user.ID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return updated == 1, nil
+}
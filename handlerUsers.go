@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/bencuci/chirpy/internal/auth"
@@ -20,12 +22,21 @@ type User struct {
 	HashedPassword string    `json:"hashed_password"`
 	Token          string    `json:"token"`
 	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	IsProtected    bool      `json:"is_protected"`
+	Handle         string    `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	AvatarURL      string    `json:"avatar_url"`
+	EmailVerified  bool      `json:"email_verified"`
+	HasPassword    bool      `json:"has_password"`
+	Role           string    `json:"role"`
 }
 
 func (cfg *apiConfig) handlerCreateUser(rw http.ResponseWriter, req *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		InviteCode string `json:"invite_code"`
 	}
 
 	decoder := json.NewDecoder(req.Body)
@@ -36,44 +47,102 @@ func (cfg *apiConfig) handlerCreateUser(rw http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	hashedPW, err := auth.HashPassword(params.Password)
+	if err := validateEmail(params.Email); err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if !cfg.checkPasswordPolicy(rw, params.Password, params.Email) {
+		return
+	}
+	if cfg.inviteOnly && params.InviteCode == "" {
+		respondWithError(rw, http.StatusForbidden, "Registration is invite-only, an invite_code is required", nil)
+		return
+	}
+
+	hashedPW, err := cfg.passwordHasher.Hash(params.Password)
 	if err != nil {
 		respondWithError(rw, http.StatusInternalServerError, "Couldn't hash the password", err)
 		return
 	}
-	createdUser, err := cfg.dbQueries.CreateUser(req.Context(), database.CreateUserParams{
+
+	// the verification token is issued with the account and emailed once
+	// both are committed
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not create user", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	createdUser, err := qtx.CreateUser(req.Context(), database.CreateUserParams{
 		Email:          params.Email,
-		HashedPassword: hashedPW,
+		HashedPassword: sql.NullString{String: hashedPW, Valid: true},
 	})
 	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(rw, http.StatusConflict, "Email is already in use", err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Could not create user", err)
+		return
+	}
+
+	// a failed signup rolls back, so it doesn't use up the invite
+	if cfg.inviteOnly {
+		inviteID, err := qtx.RedeemInvite(req.Context(), auth.HashToken(auth.NormalizeInviteCode(params.InviteCode)))
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusForbidden, "Invalid, used up or expired invite code", err)
+			return
+		}
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't redeem invite", err)
+			return
+		}
+		err = qtx.CreateInviteRedemption(req.Context(), database.CreateInviteRedemptionParams{
+			InviteID: inviteID,
+			UserID:   createdUser.ID,
+		})
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't redeem invite", err)
+			return
+		}
+	}
+
+	verificationToken, err := issueVerificationToken(req.Context(), qtx, createdUser)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create verification token", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
 		respondWithError(rw, http.StatusInternalServerError, "Could not create user", err)
 		return
 	}
 
-	user := User{
-		ID:        createdUser.ID,
-		CreatedAt: createdUser.CreatedAt,
-		UpdatedAt: createdUser.UpdatedAt,
-		Email:     createdUser.Email,
+	// a failed send leaves the account unverified, the user can ask for
+	// another email
+	if err := cfg.sendVerificationEmail(req.Context(), createdUser.Email, verificationToken); err != nil {
+		log.Printf("Couldn't send verification email: %v", err)
 	}
 
-	respondWithJSON(rw, http.StatusCreated, user)
+	respondWithJSON(rw, http.StatusCreated, databaseUserToUser(createdUser))
 }
 
 func (cfg *apiConfig) handlerUpdateUser(rw http.ResponseWriter, req *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email           string  `json:"email"`
+		Password        string  `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+		IsProtected     *bool   `json:"is_protected"`
+		Handle          *string `json:"handle"`
+		DisplayName     *string `json:"display_name"`
+		Bio             *string `json:"bio"`
+		AvatarURL       *string `json:"avatar_url"`
 	}
 
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.secret)
-	if err != nil {
-		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersWrite)
+	if !ok {
 		return
 	}
 
@@ -84,29 +153,373 @@ func (cfg *apiConfig) handlerUpdateUser(rw http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	hashedPW, err := auth.HashPassword(params.Password)
+	if err := validateEmail(params.Email); err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	currentUser, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	// PUT always replaces the email and password, so like PATCH it needs
+	// the current password whatever token the request carries
+	if !cfg.checkCurrentPassword(rw, req, currentUser, params.CurrentPassword) {
+		return
+	}
+
+	// validate everything up front so a bad field doesn't leave a partial update
+	renaming := params.Handle != nil && *params.Handle != currentUser.Handle.String
+	if renaming {
+		if err := validateHandle(*params.Handle); err != nil {
+			respondWithError(rw, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		if currentUser.HandleUpdatedAt.Valid && time.Since(currentUser.HandleUpdatedAt.Time) < handleRenameCooldown {
+			respondWithError(rw, http.StatusTooManyRequests, "Handle was changed too recently", nil)
+			return
+		}
+	}
+
+	displayName := currentUser.DisplayName
+	if params.DisplayName != nil {
+		displayName = *params.DisplayName
+	}
+	bio := currentUser.Bio
+	if params.Bio != nil {
+		bio = *params.Bio
+	}
+	avatarURL := currentUser.AvatarURL
+	if params.AvatarURL != nil {
+		avatarURL = *params.AvatarURL
+	}
+	if err := validateProfile(displayName, bio, avatarURL); err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if !cfg.checkPasswordPolicy(rw, params.Password, params.Email) {
+		return
+	}
+
+	hashedPW, err := cfg.passwordHasher.Hash(params.Password)
 	if err != nil {
 		respondWithError(rw, http.StatusInternalServerError, "Couldn't hash the password", err)
 		return
 	}
 
-	user, err := cfg.dbQueries.UpdateUser(req.Context(), database.UpdateUserParams{
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not update the user", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	user, err := qtx.UpdateUser(req.Context(), database.UpdateUserParams{
 		Email:          params.Email,
-		HashedPassword: hashedPW,
+		HashedPassword: sql.NullString{String: hashedPW, Valid: true},
 		ID:             userID,
 	})
 	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(rw, http.StatusConflict, "Email is already in use", err)
+			return
+		}
 		respondWithError(rw, http.StatusInternalServerError, "Could not update the user", err)
 		return
 	}
 
-	respondWithJSON(rw, http.StatusOK, User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+	// a new address has to be verified again, a change of case is the
+	// same address
+	verificationToken := ""
+	if !strings.EqualFold(user.Email, currentUser.Email) {
+		verificationToken, err = issueVerificationToken(req.Context(), qtx, user)
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't create verification token", err)
+			return
+		}
+		// login links sent to the old address stop working
+		if err := qtx.DeleteMagicLinkTokens(req.Context(), userID); err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke login links", err)
+			return
+		}
+	}
+
+	if renaming {
+		user, err = qtx.UpdateUserHandle(req.Context(), database.UpdateUserHandleParams{
+			Handle: sql.NullString{String: *params.Handle, Valid: true},
+			ID:     userID,
+		})
+		if err != nil {
+			if isUniqueViolation(err) {
+				respondWithError(rw, http.StatusConflict, "Handle is already taken", err)
+				return
+			}
+			respondWithError(rw, http.StatusInternalServerError, "Could not update the handle", err)
+			return
+		}
+	}
+
+	user, err = qtx.UpdateUserProfile(req.Context(), database.UpdateUserProfileParams{
+		DisplayName: displayName,
+		Bio:         bio,
+		AvatarURL:   avatarURL,
+		ID:          userID,
 	})
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not update the profile", err)
+		return
+	}
+
+	if params.IsProtected != nil && *params.IsProtected != user.IsProtected {
+		user, err = qtx.SetUserProtected(req.Context(), database.SetUserProtectedParams{
+			IsProtected: *params.IsProtected,
+			ID:          userID,
+		})
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Could not update the user", err)
+			return
+		}
+		// going public lets everyone who asked in
+		if !user.IsProtected {
+			err = qtx.AcceptAllFollowRequests(req.Context(), userID)
+			if err != nil {
+				respondWithError(rw, http.StatusInternalServerError, "Couldn't accept pending follow requests", err)
+				return
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not update the user", err)
+		return
+	}
+
+	if verificationToken != "" {
+		if err := cfg.sendVerificationEmail(req.Context(), user.Email, verificationToken); err != nil {
+			log.Printf("Couldn't send verification email: %v", err)
+		}
+	}
+
+	cfg.recordAuditEvent(req, auditPasswordChanged, userID, userID, "")
+	if user.Email != currentUser.Email {
+		cfg.recordAuditEvent(req, auditEmailChanged, userID, userID, "")
+	}
+	respondWithJSON(rw, http.StatusOK, databaseUserToUser(user))
+}
+
+// handlerPatchUser only touches the fields present in the body. Changing
+// the email or password needs the current password as well as the token.
+func (cfg *apiConfig) handlerPatchUser(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+		IsProtected     *bool   `json:"is_protected"`
+		Handle          *string `json:"handle"`
+		DisplayName     *string `json:"display_name"`
+		Bio             *string `json:"bio"`
+		AvatarURL       *string `json:"avatar_url"`
+	}
+
+	userID, ok := cfg.authenticate(rw, req, auth.ScopeUsersWrite)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	currentUser, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	changingEmail := params.Email != nil && *params.Email != currentUser.Email
+	changingPassword := params.Password != nil
+	if changingEmail || changingPassword {
+		if !cfg.checkCurrentPassword(rw, req, currentUser, params.CurrentPassword) {
+			return
+		}
+	}
+
+	// validate everything up front so a bad field doesn't leave a partial update
+	email := currentUser.Email
+	if changingEmail {
+		if err := validateEmail(*params.Email); err != nil {
+			respondWithError(rw, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		email = *params.Email
+	}
+
+	renaming := params.Handle != nil && *params.Handle != currentUser.Handle.String
+	if renaming {
+		if err := validateHandle(*params.Handle); err != nil {
+			respondWithError(rw, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		if currentUser.HandleUpdatedAt.Valid && time.Since(currentUser.HandleUpdatedAt.Time) < handleRenameCooldown {
+			respondWithError(rw, http.StatusTooManyRequests, "Handle was changed too recently", nil)
+			return
+		}
+	}
+
+	updatingProfile := params.DisplayName != nil || params.Bio != nil || params.AvatarURL != nil
+	displayName := currentUser.DisplayName
+	if params.DisplayName != nil {
+		displayName = *params.DisplayName
+	}
+	bio := currentUser.Bio
+	if params.Bio != nil {
+		bio = *params.Bio
+	}
+	avatarURL := currentUser.AvatarURL
+	if params.AvatarURL != nil {
+		avatarURL = *params.AvatarURL
+	}
+	if updatingProfile {
+		if err := validateProfile(displayName, bio, avatarURL); err != nil {
+			respondWithError(rw, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+	}
+
+	var hashedPW string
+	if changingPassword {
+		if !cfg.checkPasswordPolicy(rw, *params.Password, email) {
+			return
+		}
+		hashedPW, err = cfg.passwordHasher.Hash(*params.Password)
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Couldn't hash the password", err)
+			return
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not update the user", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	verificationToken := ""
+	if changingEmail {
+		user, err := qtx.UpdateUserEmail(req.Context(), database.UpdateUserEmailParams{
+			Email: email,
+			ID:    userID,
+		})
+		if err != nil {
+			if isUniqueViolation(err) {
+				respondWithError(rw, http.StatusConflict, "Email is already in use", err)
+				return
+			}
+			respondWithError(rw, http.StatusInternalServerError, "Could not update the email", err)
+			return
+		}
+		if !strings.EqualFold(user.Email, currentUser.Email) {
+			verificationToken, err = issueVerificationToken(req.Context(), qtx, user)
+			if err != nil {
+				respondWithError(rw, http.StatusInternalServerError, "Couldn't create verification token", err)
+				return
+			}
+			if err := qtx.DeleteMagicLinkTokens(req.Context(), userID); err != nil {
+				respondWithError(rw, http.StatusInternalServerError, "Couldn't revoke login links", err)
+				return
+			}
+		}
+	}
+
+	if changingPassword {
+		err = qtx.UpdateUserPassword(req.Context(), database.UpdateUserPasswordParams{
+			HashedPassword: sql.NullString{String: hashedPW, Valid: true},
+			ID:             userID,
+		})
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Could not update the password", err)
+			return
+		}
+	}
+
+	if renaming {
+		_, err = qtx.UpdateUserHandle(req.Context(), database.UpdateUserHandleParams{
+			Handle: sql.NullString{String: *params.Handle, Valid: true},
+			ID:     userID,
+		})
+		if err != nil {
+			if isUniqueViolation(err) {
+				respondWithError(rw, http.StatusConflict, "Handle is already taken", err)
+				return
+			}
+			respondWithError(rw, http.StatusInternalServerError, "Could not update the handle", err)
+			return
+		}
+	}
+
+	if updatingProfile {
+		_, err = qtx.UpdateUserProfile(req.Context(), database.UpdateUserProfileParams{
+			DisplayName: displayName,
+			Bio:         bio,
+			AvatarURL:   avatarURL,
+			ID:          userID,
+		})
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Could not update the profile", err)
+			return
+		}
+	}
+
+	if params.IsProtected != nil && *params.IsProtected != currentUser.IsProtected {
+		_, err = qtx.SetUserProtected(req.Context(), database.SetUserProtectedParams{
+			IsProtected: *params.IsProtected,
+			ID:          userID,
+		})
+		if err != nil {
+			respondWithError(rw, http.StatusInternalServerError, "Could not update the user", err)
+			return
+		}
+		// going public lets everyone who asked in
+		if !*params.IsProtected {
+			err = qtx.AcceptAllFollowRequests(req.Context(), userID)
+			if err != nil {
+				respondWithError(rw, http.StatusInternalServerError, "Couldn't accept pending follow requests", err)
+				return
+			}
+		}
+	}
+
+	user, err := qtx.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not update the user", err)
+		return
+	}
+
+	if verificationToken != "" {
+		if err := cfg.sendVerificationEmail(req.Context(), user.Email, verificationToken); err != nil {
+			log.Printf("Couldn't send verification email: %v", err)
+		}
+	}
+
+	if changingPassword {
+		cfg.recordAuditEvent(req, auditPasswordChanged, userID, userID, "")
+	}
+	if changingEmail {
+		cfg.recordAuditEvent(req, auditEmailChanged, userID, userID, "")
+	}
+	respondWithJSON(rw, http.StatusOK, databaseUserToUser(user))
 }
 
 func (cfg *apiConfig) handlerUpgradeMembership(rw http.ResponseWriter, req *http.Request) {
@@ -146,5 +559,78 @@ func (cfg *apiConfig) handlerUpgradeMembership(rw http.ResponseWriter, req *http
 		return
 	}
 
+	cfg.recordAuditEvent(req, auditMembershipUpgraded, uuid.Nil, params.Data.UserID, "polka webhook")
 	respondWithJSON(rw, http.StatusNoContent, nil)
 }
+
+// checkPasswordPolicy responds with a 400 listing every failed rule and
+// returns false if the password isn't allowed.
+func (cfg *apiConfig) checkPasswordPolicy(rw http.ResponseWriter, password, email string) bool {
+	type failedRule struct {
+		Rule    string `json:"rule"`
+		Message string `json:"message"`
+	}
+	type response struct {
+		Error       string       `json:"error"`
+		FailedRules []failedRule `json:"failed_rules"`
+	}
+
+	violations := cfg.passwordPolicy.Check(password, email)
+	if len(violations) == 0 {
+		return true
+	}
+
+	failedRules := []failedRule{}
+	for _, v := range violations {
+		failedRules = append(failedRules, failedRule{Rule: v.Rule, Message: v.Message})
+	}
+	respondWithJSON(rw, http.StatusBadRequest, response{
+		Error:       "Password doesn't meet the password policy",
+		FailedRules: failedRules,
+	})
+	return false
+}
+
+// checkCurrentPassword responds and returns false unless password is the
+// user's current one. Wrong guesses count toward the login lockout, so a
+// stolen access token can't be used to brute-force the password.
+func (cfg *apiConfig) checkCurrentPassword(rw http.ResponseWriter, req *http.Request, user database.User, password string) bool {
+	if !user.HashedPassword.Valid {
+		respondWithError(rw, http.StatusForbidden, "Your account has no password yet, set one with a password reset first", nil)
+		return false
+	}
+	if password == "" {
+		respondWithError(rw, http.StatusBadRequest, "current_password is required to change the email or password", nil)
+		return false
+	}
+
+	email := normalizeLoginEmail(user.Email)
+	if !cfg.checkLoginLockout(rw, req, email) {
+		return false
+	}
+	if err := cfg.passwordHasher.Check(password, user.HashedPassword.String); err != nil {
+		cfg.recordLoginFailure(req, email)
+		cfg.recordAuditEvent(req, auditReauthFailed, user.ID, user.ID, "wrong current password")
+		respondWithError(rw, http.StatusForbidden, "Current password is incorrect", err)
+		return false
+	}
+	return true
+}
+
+func databaseUserToUser(user database.User) User {
+	return User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		IsProtected:   user.IsProtected,
+		Handle:        user.Handle.String,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarURL:     user.AvatarURL,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		HasPassword:   user.HashedPassword.Valid,
+		Role:          user.Role,
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+
+	"github.com/bencuci/chirpy/internal/auth"
+	"github.com/bencuci/chirpy/internal/database"
+	"github.com/bencuci/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+// maxVerificationEmails can be sent to an account every 15 minutes.
+const maxVerificationEmails = 3
+
+func (cfg *apiConfig) handlerVerifyEmail(rw http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Could not decode request", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// the token only works while the account still has the address it was
+	// sent to
+	userID, err := qtx.UseEmailVerificationToken(req.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(rw, http.StatusBadRequest, "Invalid or expired verification token", err)
+			return
+		}
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	user, err := qtx.VerifyUserEmail(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, databaseUserToUser(user))
+}
+
+// issueVerificationToken replaces the user's outstanding verification
+// tokens with a new one for their current address. q lets callers issue it
+// inside their transaction and send it with sendVerificationEmail once that
+// has committed, so the transaction isn't held open during the SMTP call.
+func issueVerificationToken(ctx context.Context, q *database.Queries, user database.User) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := q.DeleteEmailVerificationTokens(ctx, user.ID); err != nil {
+		return "", fmt.Errorf("couldn't delete old verification tokens: %w", err)
+	}
+	err = q.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't store verification token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, email, token string) error {
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email",
+		Body: fmt.Sprintf(
+			"Welcome to Chirpy!\n\nConfirm your email by sending this token to POST /api/users/verify:\n\n%s\n\nIt expires in 24 hours. You can ask for a new one at POST /api/users/verify/resend.",
+			token,
+		),
+	})
+}
+
+// handlerResendVerification emails a new verification token, replacing any
+// earlier ones, for accounts that lost theirs or let it expire.
+func (cfg *apiConfig) handlerResendVerification(rw http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(rw, http.StatusUnauthorized, err.Error(), err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't resend verification email", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// locking the user makes the count and the new token one step, so
+	// parallel requests can't go past the limit
+	user, err := qtx.GetUserByIDForUpdate(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(rw, http.StatusConflict, "Email is already verified", nil)
+		return
+	}
+
+	sent, err := qtx.CountRecentEmailVerificationTokens(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't check the rate limit", err)
+		return
+	}
+	if sent >= maxVerificationEmails {
+		respondWithError(rw, http.StatusTooManyRequests, "Too many verification emails requested, try again later", nil)
+		return
+	}
+
+	verificationToken, err := issueVerificationToken(req.Context(), qtx, user)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't create verification token", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't resend verification email", err)
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(req.Context(), user.Email, verificationToken); err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't send verification email", err)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusNoContent, nil)
+}
+
+// requireVerifiedEmail responds with 403 and returns false if the user
+// hasn't confirmed their email yet.
+func (cfg *apiConfig) requireVerifiedEmail(rw http.ResponseWriter, req *http.Request, userID uuid.UUID) bool {
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Couldn't get user", err)
+		return false
+	}
+	if !user.EmailVerifiedAt.Valid {
+		respondWithError(rw, http.StatusForbidden, "Verify your email first", nil)
+		return false
+	}
+
+	return true
+}
+
+func validateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return errors.New("Invalid email address")
+	}
+
+	return nil
+}
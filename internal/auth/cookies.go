@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// Browser sessions keep the access and refresh tokens in HttpOnly cookies.
+// The CSRF cookie is readable by scripts so the client can echo it back
+// in CSRFHeader (double-submit).
+const (
+	AccessTokenCookie  = "chirpy_access_token"
+	RefreshTokenCookie = "chirpy_refresh_token"
+	CSRFCookie         = "chirpy_csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+	// CSRFFormField carries the token in HTML form posts, which can't set
+	// headers.
+	CSRFFormField = "csrf_token"
+)
+
+var ErrCSRFTokenMismatch = errors.New("missing or invalid CSRF token")
+
+// MakeCSRFToken returns a random token for the CSRF cookie.
+func MakeCSRFToken() (string, error) {
+	return MakeRefreshToken()
+}
+
+// GetRefreshToken reads the refresh token from the Authorization header,
+// falling back to the refresh token cookie.
+func GetRefreshToken(headers http.Header) (string, error) {
+	token, err := getBearerHeader(headers)
+	if errors.Is(err, ErrNoAuthHeaderIncluded) {
+		if cookie, ok := getCookie(headers, RefreshTokenCookie); ok {
+			return cookie, nil
+		}
+	}
+	return token, err
+}
+
+// UsesSessionCookies reports whether the request authenticates with
+// cookies rather than an Authorization header, which is the only case a
+// cross-site request could be made on the user's behalf.
+func UsesSessionCookies(headers http.Header) bool {
+	if headers.Get("Authorization") != "" {
+		return false
+	}
+	_, access := getCookie(headers, AccessTokenCookie)
+	_, refresh := getCookie(headers, RefreshTokenCookie)
+	return access || refresh
+}
+
+// CheckCSRF compares the token a request presented, from the CSRF header
+// or a form field, against the CSRF cookie. A cross-site page can make the
+// browser send the cookie but can't read it to copy it into the request.
+func CheckCSRF(headers http.Header, token string) error {
+	cookie, ok := getCookie(headers, CSRFCookie)
+	if !ok || token == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(token)) != 1 {
+		return ErrCSRFTokenMismatch
+	}
+	return nil
+}
+
+// GetCSRFCookie returns the CSRF token of a browser session, for pages
+// that need to embed it in a form.
+func GetCSRFCookie(headers http.Header) (string, bool) {
+	return getCookie(headers, CSRFCookie)
+}
+
+func getCookie(headers http.Header, name string) (string, bool) {
+	req := http.Request{Header: headers}
+	cookie, err := req.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTokensFallBackToCookies(t *testing.T) {
+	h := http.Header{}
+	h.Add("Cookie", AccessTokenCookie+"=access; "+RefreshTokenCookie+"=refresh")
+
+	if got, err := GetBearerToken(h); err != nil || got != "access" {
+		t.Errorf("GetBearerToken() = %q, %v, want access cookie", got, err)
+	}
+	if got, err := GetRefreshToken(h); err != nil || got != "refresh" {
+		t.Errorf("GetRefreshToken() = %q, %v, want refresh cookie", got, err)
+	}
+	if !UsesSessionCookies(h) {
+		t.Error("UsesSessionCookies() = false with only cookies")
+	}
+
+	// the header wins over the cookie
+	h.Set("Authorization", "Bearer header")
+	if got, err := GetBearerToken(h); err != nil || got != "header" {
+		t.Errorf("GetBearerToken() = %q, %v, want header token", got, err)
+	}
+	if UsesSessionCookies(h) {
+		t.Error("UsesSessionCookies() = true with an Authorization header")
+	}
+}
+
+func TestCheckCSRF(t *testing.T) {
+	tests := []struct {
+		name    string
+		cookie  string
+		token   string
+		wantErr bool
+	}{
+		{name: "matching", cookie: "abc123", token: "abc123"},
+		{name: "mismatch", cookie: "abc123", token: "abc124", wantErr: true},
+		{name: "missing token", cookie: "abc123", wantErr: true},
+		{name: "missing cookie", token: "abc123", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.cookie != "" {
+				h.Add("Cookie", CSRFCookie+"="+tt.cookie)
+			}
+
+			err := CheckCSRF(h, tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckCSRF() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
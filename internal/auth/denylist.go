@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// Denylist holds the IDs (jti) of revoked tokens until the tokens would
+// have expired anyway. It lives in memory so validating a token never
+// waits on the database; callers keep it in sync with their store.
+type Denylist struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+func NewDenylist() *Denylist {
+	return &Denylist{entries: map[string]time.Time{}}
+}
+
+func (d *Denylist) Add(jti string, expiresAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries[jti] = expiresAt
+}
+
+func (d *Denylist) Contains(jti string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	expiresAt, ok := d.entries[jti]
+	return ok && time.Now().Before(expiresAt)
+}
+
+// Prune drops entries whose tokens have expired.
+func (d *Denylist) Prune() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for jti, expiresAt := range d.entries {
+		if !now.Before(expiresAt) {
+			delete(d.entries, jti)
+		}
+	}
+}
+
+func (d *Denylist) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.entries)
+}
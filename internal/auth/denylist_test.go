@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDenylist(t *testing.T) {
+	d := NewDenylist()
+	d.Add("live", time.Now().Add(time.Hour))
+	d.Add("expired", time.Now().Add(-time.Second))
+
+	if !d.Contains("live") {
+		t.Error("Contains() missed a live entry")
+	}
+	if d.Contains("expired") {
+		t.Error("Contains() returned an expired entry")
+	}
+	if d.Contains("unknown") {
+		t.Error("Contains() returned an unknown entry")
+	}
+
+	d.Prune()
+	if d.Len() != 1 {
+		t.Errorf("Len() after Prune() = %d, want 1", d.Len())
+	}
+}
+
+func TestValidateJWTChecksDenylist(t *testing.T) {
+	keys := NewHMACKeySet("secret")
+	denylist := NewDenylist()
+	keys.UseDenylist(denylist)
+
+	revoked, err := MakeAccessToken(uuid.New(), RoleUser, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken() error = %v", err)
+	}
+	other, _ := MakeAccessToken(uuid.New(), RoleUser, keys, time.Hour)
+	if revoked.ID == "" || revoked.ID == other.ID {
+		t.Fatalf("MakeAccessToken() IDs = %q, %q, want unique", revoked.ID, other.ID)
+	}
+
+	denylist.Add(revoked.ID, revoked.ExpiresAt)
+
+	if _, err := ValidateJWT(revoked.Token, keys); err != ErrTokenRevoked {
+		t.Errorf("ValidateJWT() error = %v, want %v", err, ErrTokenRevoked)
+	}
+	if _, err := ValidateJWT(other.Token, keys); err != nil {
+		t.Errorf("ValidateJWT() error = %v for a token that wasn't revoked", err)
+	}
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+)
+
+// inviteCodeEncoding avoids padding so codes are only letters and digits.
+var inviteCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MakeInviteCode returns a random 80-bit code meant to be read and typed
+// by people, grouped like ABCD-EFGH-IJKL-MNOP.
+func MakeInviteCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := inviteCodeEncoding.EncodeToString(raw)
+
+	groups := make([]string, 0, len(code)/4)
+	for i := 0; i < len(code); i += 4 {
+		groups = append(groups, code[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// NormalizeInviteCode undoes the ways people retype a code (case, dashes,
+// spaces) so it hashes the same as the code that was issued.
+func NormalizeInviteCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ':
+			return -1
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return r
+	}, strings.TrimSpace(code))
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMakeInviteCode(t *testing.T) {
+	code, err := MakeInviteCode()
+	if err != nil {
+		t.Fatalf("MakeInviteCode() error = %v", err)
+	}
+	if !regexp.MustCompile(`^[A-Z2-7]{4}-[A-Z2-7]{4}-[A-Z2-7]{4}-[A-Z2-7]{4}$`).MatchString(code) {
+		t.Errorf("MakeInviteCode() = %q, want four groups of four base32 characters", code)
+	}
+
+	other, _ := MakeInviteCode()
+	if code == other {
+		t.Error("MakeInviteCode() returned the same code twice")
+	}
+}
+
+func TestNormalizeInviteCode(t *testing.T) {
+	code, err := MakeInviteCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := NormalizeInviteCode(code)
+
+	for _, typed := range []string{
+		" " + code + " ",
+		strings.ReplaceAll(code, "-", ""),
+		strings.ReplaceAll(code, "-", " "),
+		strings.ToLower(code),
+	} {
+		if got := NormalizeInviteCode(typed); got != want {
+			t.Errorf("NormalizeInviteCode(%q) = %q, want %q", typed, got, want)
+		}
+	}
+}
@@ -15,56 +15,209 @@ type TokenType string
 
 const (
 	TokenTypeAccess TokenType = "chirpy-access"
+	// TokenTypeTwoFactorChallenge proves the password step of a login
+	// and can only be exchanged for an access token with a 2FA code.
+	TokenTypeTwoFactorChallenge TokenType = "chirpy-2fa-challenge"
 )
 
+// accessClaims carries the user's role so middleware can authorize a
+// request without a database lookup. Tokens issued to OAuth clients carry
+// the client and the granted scopes instead of a role.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Role     Role   `json:"role,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+// AccessToken is a signed access JWT along with the ID and expiry needed
+// to revoke it later.
+type AccessToken struct {
+	Token     string
+	ID        string
+	ExpiresAt time.Time
+}
+
+// Claims is what a verified access token says about its bearer.
+type Claims struct {
+	UserID uuid.UUID
+	Role   Role
+	// ClientID and Scope are only set on tokens issued to OAuth clients.
+	ClientID  string
+	Scope     string
+	ID        string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// ErrDelegatedToken is returned by ValidateJWT for a token issued to an
+// OAuth client, which is only good for endpoints that check its scopes.
+var ErrDelegatedToken = errors.New("token was issued to a third-party app")
+
 func MakeJWT(
 	userID uuid.UUID,
-	tokenSecret string,
+	role Role,
+	keys *KeySet,
 	expiresIn time.Duration,
 ) (string, error) {
-	signingKey := []byte(tokenSecret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    string(TokenTypeAccess),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
+	token, err := makeJWT(userID, keys, expiresIn, TokenTypeAccess, accessClaims{Role: role})
+	return token.Token, err
+}
+
+func MakeAccessToken(userID uuid.UUID, role Role, keys *KeySet, expiresIn time.Duration) (AccessToken, error) {
+	return makeJWT(userID, keys, expiresIn, TokenTypeAccess, accessClaims{Role: role})
+}
+
+// MakeDelegatedAccessToken issues an access token to an OAuth client
+// acting for the user. The client is both the aud and client_id claim.
+func MakeDelegatedAccessToken(userID uuid.UUID, clientID, scope string, keys *KeySet, expiresIn time.Duration) (AccessToken, error) {
+	return makeJWT(userID, keys, expiresIn, TokenTypeAccess, accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{clientID}},
+		ClientID:         clientID,
+		Scope:            scope,
 	})
-	return token.SignedString(signingKey)
 }
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claimsStruct := jwt.RegisteredClaims{}
+
+// ValidateJWT returns the user behind a first-party access token.
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims, err := ParseAccessToken(tokenString, keys)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if claims.ClientID != "" {
+		return uuid.Nil, ErrDelegatedToken
+	}
+	return claims.UserID, nil
+}
+
+// ValidateJWTRole is ValidateJWT that also returns the role claim.
+// Tokens issued before roles existed count as RoleUser.
+func ValidateJWTRole(tokenString string, keys *KeySet) (uuid.UUID, Role, error) {
+	claims, err := ParseAccessToken(tokenString, keys)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	if claims.ClientID != "" {
+		return uuid.Nil, "", ErrDelegatedToken
+	}
+	if claims.Role == "" {
+		claims.Role = RoleUser
+	}
+	return claims.UserID, claims.Role, nil
+}
+
+// ParseAccessToken verifies any access token, first-party or delegated,
+// and returns its claims.
+func ParseAccessToken(tokenString string, keys *KeySet) (Claims, error) {
+	return validateJWT(tokenString, keys, TokenTypeAccess)
+}
+
+func MakeChallengeJWT(userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	token, err := makeJWT(userID, keys, expiresIn, TokenTypeTwoFactorChallenge, accessClaims{})
+	return token.Token, err
+}
+
+func ValidateChallengeJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims, err := validateJWT(tokenString, keys, TokenTypeTwoFactorChallenge)
+	return claims.UserID, err
+}
+
+// makeJWT fills in the registered claims every token has and signs claims.
+func makeJWT(
+	userID uuid.UUID,
+	keys *KeySet,
+	expiresIn time.Duration,
+	tokenType TokenType,
+	claims accessClaims,
+) (AccessToken, error) {
+	now := time.Now().UTC()
+	// NumericDate has second precision, match it so ExpiresAt is exact
+	expiresAt := now.Add(expiresIn).Truncate(time.Second)
+	jti := uuid.NewString()
+
+	claims.Issuer = string(tokenType)
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	claims.Subject = userID.String()
+	claims.ID = jti
+
+	kid, key := keys.signingKey()
+	token := jwt.NewWithClaims(key.method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key.sign)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	return AccessToken{Token: signed, ID: jti, ExpiresAt: expiresAt}, nil
+}
+
+func validateJWT(tokenString string, keys *KeySet, tokenType TokenType) (Claims, error) {
+	claimsStruct := accessClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&claimsStruct,
-		func(token *jwt.Token) (any, error) { return []byte(tokenSecret), nil },
+		keys.keyFunc,
 	)
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, err
 	}
 
 	userIDString, err := token.Claims.GetSubject()
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, err
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return Claims{}, err
 	}
-	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+	if issuer != string(tokenType) {
+		return Claims{}, errors.New("invalid issuer")
+	}
+
+	// tokens issued before jti existed can't be revoked individually
+	if keys.denylist != nil && claimsStruct.ID != "" && keys.denylist.Contains(claimsStruct.ID) {
+		return Claims{}, ErrTokenRevoked
 	}
 
 	id, err := uuid.Parse(userIDString)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+		return Claims{}, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	claims := Claims{
+		UserID:   id,
+		Role:     claimsStruct.Role,
+		ClientID: claimsStruct.ClientID,
+		Scope:    claimsStruct.Scope,
+		ID:       claimsStruct.ID,
+	}
+	if claimsStruct.IssuedAt != nil {
+		claims.IssuedAt = claimsStruct.IssuedAt.Time
+	}
+	if claimsStruct.ExpiresAt != nil {
+		claims.ExpiresAt = claimsStruct.ExpiresAt.Time
 	}
-	return id, nil
+	return claims, nil
 }
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
 
+// GetBearerToken reads the token from the Authorization header, falling
+// back to the access token cookie of a browser session.
 func GetBearerToken(headers http.Header) (string, error) {
+	token, err := getBearerHeader(headers)
+	if errors.Is(err, ErrNoAuthHeaderIncluded) {
+		if cookie, ok := getCookie(headers, AccessTokenCookie); ok {
+			return cookie, nil
+		}
+	}
+	return token, err
+}
+
+func getBearerHeader(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
 		return "", ErrNoAuthHeaderIncluded
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 	"testing"
 	"time"
@@ -10,7 +11,7 @@ import (
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	validToken, _ := MakeJWT(userID, RoleUser, NewHMACKeySet("secret"), time.Hour)
 
 	tests := []struct {
 		name        string
@@ -44,7 +45,7 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			gotUserID, err := ValidateJWT(tt.tokenString, NewHMACKeySet(tt.tokenSecret))
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -56,6 +57,65 @@ func TestValidateJWT(t *testing.T) {
 	}
 }
 
+func TestValidateJWTRejectsOtherTokenTypes(t *testing.T) {
+	userID := uuid.New()
+	keys := NewHMACKeySet("secret")
+	challenge, _ := MakeChallengeJWT(userID, keys, time.Minute)
+	access, _ := MakeJWT(userID, RoleUser, keys, time.Minute)
+
+	if _, err := ValidateJWT(challenge, keys); err == nil {
+		t.Error("ValidateJWT() accepted a 2FA challenge token")
+	}
+	if _, err := ValidateChallengeJWT(access, keys); err == nil {
+		t.Error("ValidateChallengeJWT() accepted an access token")
+	}
+	if got, err := ValidateChallengeJWT(challenge, keys); err != nil || got != userID {
+		t.Errorf("ValidateChallengeJWT() = %v, %v, want %v", got, err, userID)
+	}
+}
+
+func TestValidateJWTRole(t *testing.T) {
+	userID := uuid.New()
+	keys := NewHMACKeySet("secret")
+
+	token, _ := MakeJWT(userID, RoleModerator, keys, time.Minute)
+	gotID, gotRole, err := ValidateJWTRole(token, keys)
+	if err != nil || gotID != userID || gotRole != RoleModerator {
+		t.Errorf("ValidateJWTRole() = %v, %v, %v, want %v, %v", gotID, gotRole, err, userID, RoleModerator)
+	}
+
+	// tokens from before roles existed have no claim
+	token, _ = MakeJWT(userID, "", keys, time.Minute)
+	if _, gotRole, _ := ValidateJWTRole(token, keys); gotRole != RoleUser {
+		t.Errorf("ValidateJWTRole() role = %q, want %q", gotRole, RoleUser)
+	}
+}
+
+func TestDelegatedAccessToken(t *testing.T) {
+	userID := uuid.New()
+	keys := NewHMACKeySet("secret")
+	token, err := MakeDelegatedAccessToken(userID, "client-1", "chirps:read", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeDelegatedAccessToken() error = %v", err)
+	}
+
+	claims, err := ParseAccessToken(token.Token, keys)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() error = %v", err)
+	}
+	if claims.UserID != userID || claims.ClientID != "client-1" || claims.Scope != "chirps:read" || claims.ID != token.ID {
+		t.Errorf("ParseAccessToken() = %+v", claims)
+	}
+
+	// first-party endpoints don't take tokens issued to other apps
+	if _, err := ValidateJWT(token.Token, keys); !errors.Is(err, ErrDelegatedToken) {
+		t.Errorf("ValidateJWT() error = %v, want %v", err, ErrDelegatedToken)
+	}
+	if _, _, err := ValidateJWTRole(token.Token, keys); !errors.Is(err, ErrDelegatedToken) {
+		t.Errorf("ValidateJWTRole() error = %v, want %v", err, ErrDelegatedToken)
+	}
+}
+
 func TestGetBearerToken(t *testing.T) {
 	tests := []struct {
 		name      string
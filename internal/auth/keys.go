@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKeyID = errors.New("unknown signing key id")
+
+type signingKey struct {
+	method jwt.SigningMethod
+	// sign is nil for keys that are only kept around to verify tokens
+	// issued before a rotation.
+	sign   any
+	verify any
+}
+
+// KeySet holds every key a token may have been signed with, indexed by
+// its kid, plus the one new tokens are signed with. With a denylist set,
+// tokens whose jti is on it fail validation.
+type KeySet struct {
+	keys      map[string]signingKey
+	activeKID string
+	denylist  *Denylist
+}
+
+// NewHMACKeySet signs and verifies HS256 tokens with a shared secret.
+// Tokens carry no kid, matching the ones issued before key rotation
+// existed.
+func NewHMACKeySet(secret string) *KeySet {
+	ks := &KeySet{keys: map[string]signingKey{}}
+	ks.AddHMAC(secret)
+	return ks
+}
+
+// AddHMAC accepts HS256 tokens without a kid. When the set already has an
+// asymmetric signing key this keeps tokens from the shared secret valid
+// until they expire.
+func (ks *KeySet) AddHMAC(secret string) {
+	key := []byte(secret)
+	ks.keys[""] = signingKey{method: jwt.SigningMethodHS256, sign: key, verify: key}
+}
+
+// LoadKeySet reads every <kid>.pem file in dir. Private keys (PKCS#8 RSA
+// or Ed25519, or PKCS#1 RSA) can sign; public keys are verify-only, which
+// is how retired keys are kept until their tokens expire. New tokens are
+// signed with signingKID.
+func LoadKeySet(dir, signingKID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{keys: map[string]signingKey{}, activeKID: signingKID}
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseSigningKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+		ks.keys[kid] = key
+	}
+
+	active, ok := ks.keys[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found in %s", signingKID, dir)
+	}
+	if active.sign == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKID)
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) UseDenylist(d *Denylist) {
+	ks.denylist = d
+}
+
+func parseSigningKey(data []byte) (signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return signingKey{}, errors.New("no PEM data found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return signingKey{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return signingKey{method: jwt.SigningMethodRS256, sign: k, verify: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return signingKey{method: jwt.SigningMethodRS256, verify: k}, nil
+	case ed25519.PrivateKey:
+		return signingKey{method: jwt.SigningMethodEdDSA, sign: k, verify: k.Public()}, nil
+	case ed25519.PublicKey:
+		return signingKey{method: jwt.SigningMethodEdDSA, verify: k}, nil
+	default:
+		return signingKey{}, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+func (ks *KeySet) signingKey() (string, signingKey) {
+	return ks.activeKID, ks.keys[ks.activeKID]
+}
+
+// keyFunc looks the verification key up by the token's kid and refuses
+// tokens whose alg doesn't match that key.
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.verify, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key, sorted by kid.
+// The HMAC secret is never published.
+func (ks *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKS{Keys: []JWK{}}
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		switch pub := key.verify.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: kid,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
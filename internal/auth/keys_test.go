@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func writeKey(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	writeKey(t, dir, "rsa-1", "PRIVATE KEY", der)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ = x509.MarshalPKCS8PrivateKey(edKey)
+	writeKey(t, dir, "ed-2", "PRIVATE KEY", der)
+
+	userID := uuid.New()
+
+	oldKeys, err := LoadKeySet(dir, "rsa-1")
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+	oldToken, err := MakeJWT(userID, RoleUser, oldKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	// rotate: sign with the Ed25519 key, keep only the RSA public key
+	pubDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	writeKey(t, dir, "rsa-1", "PUBLIC KEY", pubDER)
+	newKeys, err := LoadKeySet(dir, "ed-2")
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+	newToken, err := MakeJWT(userID, RoleUser, newKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if got, err := ValidateJWT(token, newKeys); err != nil || got != userID {
+			t.Errorf("ValidateJWT(%s token) = %v, %v, want %v", name, got, err, userID)
+		}
+	}
+
+	if _, err := LoadKeySet(dir, "rsa-1"); err == nil {
+		t.Error("LoadKeySet() accepted a public key for signing")
+	}
+
+	jwks := newKeys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2", len(jwks.Keys))
+	}
+	if jwks.Keys[0].Kid != "ed-2" || jwks.Keys[0].Alg != "EdDSA" || jwks.Keys[0].X == "" {
+		t.Errorf("JWKS() Ed25519 key = %+v", jwks.Keys[0])
+	}
+	if jwks.Keys[1].Kid != "rsa-1" || jwks.Keys[1].Alg != "RS256" || jwks.Keys[1].E != "AQAB" {
+		t.Errorf("JWKS() RSA key = %+v", jwks.Keys[1])
+	}
+}
+
+func TestKeySetRejectsUnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	writeKey(t, dir, "ed-1", "PRIVATE KEY", der)
+
+	keys, err := LoadKeySet(dir, "ed-1")
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+
+	hmacToken, _ := MakeJWT(uuid.New(), RoleUser, NewHMACKeySet("secret"), time.Hour)
+	if _, err := ValidateJWT(hmacToken, keys); err == nil {
+		t.Error("ValidateJWT() accepted a token without a known kid")
+	}
+
+	keys.AddHMAC("secret")
+	if _, err := ValidateJWT(hmacToken, keys); err != nil {
+		t.Errorf("ValidateJWT() rejected an HS256 token after AddHMAC: %v", err)
+	}
+	if len(keys.JWKS().Keys) != 1 {
+		t.Error("JWKS() published the HMAC secret")
+	}
+}
@@ -0,0 +1,28 @@
+package auth
+
+import "time"
+
+// LockoutPolicy locks a login key out once it reaches Threshold failed
+// attempts, doubling the lock with every further failure up to MaxDelay.
+type LockoutPolicy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Duration returns how long to lock out after the given number of
+// consecutive failures, or 0 if the key isn't locked yet.
+func (p LockoutPolicy) Duration(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
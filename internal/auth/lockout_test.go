@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicyDuration(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 4, want: 0},
+		{failures: 5, want: 30 * time.Second},
+		{failures: 6, want: time.Minute},
+		{failures: 8, want: 4 * time.Minute},
+		{failures: 11, want: 32 * time.Minute},
+		{failures: 12, want: time.Hour},
+		{failures: 1000, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Duration(tt.failures); got != tt.want {
+			t.Errorf("Duration(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
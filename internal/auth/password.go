@@ -1,19 +1,164 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrEmptyPassword     = errors.New("password is empty")
+	ErrPasswordMismatch  = errors.New("password doesn't match")
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+)
+
+// Argon2Params are the argon2id cost settings. The defaults follow the
+// OWASP recommendation of 19 MiB, 2 iterations and 1 thread.
+type Argon2Params struct {
+	MemoryKiB   uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+var DefaultArgon2Params = Argon2Params{
+	MemoryKiB:   19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// PasswordHasher hashes new passwords with argon2id and verifies both
+// argon2id and legacy bcrypt hashes. Hashes are stored in the PHC string
+// format ($argon2id$v=19$m=...,t=...,p=...$salt$key), so each one records
+// the algorithm and parameters it was made with.
+type PasswordHasher struct {
+	params Argon2Params
+
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+func NewPasswordHasher(params Argon2Params) *PasswordHasher {
+	return &PasswordHasher{params: params}
+}
+
+var defaultPasswordHasher = NewPasswordHasher(DefaultArgon2Params)
+
 func HashPassword(password string) (string, error) {
-	hashedPW, err := bcrypt.GenerateFromPassword([]byte(password), 10)
-	if err != nil {
+	return defaultPasswordHasher.Hash(password)
+}
+
+func CheckPasswordHash(password, hash string) error {
+	return defaultPasswordHasher.Check(password, hash)
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
 		return "", fmt.Errorf("Could not hash the password: %v", err)
 	}
-	return string(hashedPW), nil
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.MemoryKiB, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.MemoryKiB,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
 }
 
-func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+// Check returns nil if password matches hash, whichever supported
+// algorithm made it.
+func (h *PasswordHasher) Check(password, hash string) error {
+	if isBcryptHash(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+	}
+
+	params, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+	got := argon2.IDKey([]byte(password), salt, params.Iterations, params.MemoryKiB, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// NeedsRehash reports whether hash was made with an older algorithm or
+// different parameters than h uses now.
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	if isBcryptHash(hash) {
+		return true
+	}
+	params, salt, _, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	params.SaltLength = uint32(len(salt))
+	return params != h.params
+}
+
+// CheckDummy takes as long as checking a real password, for requests
+// where there is no hash to check against, so they can't be told apart
+// by timing.
+func (h *PasswordHasher) CheckDummy(password string) {
+	h.dummyOnce.Do(func() {
+		h.dummyHash, _ = h.Hash("chirpy-dummy-password")
+	})
+	h.Check(password, h.dummyHash)
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func decodeArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	var params Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.MemoryKiB, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
 }
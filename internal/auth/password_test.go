@@ -1,6 +1,11 @@
 package auth
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 func TestCheckPasswordHash(t *testing.T) {
 	password := "password1234567"
@@ -13,3 +18,45 @@ func TestCheckPasswordHash(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestPasswordHasherUpgrade(t *testing.T) {
+	password := "password1234567"
+	hasher := NewPasswordHasher(DefaultArgon2Params)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hasher.Check(password, string(legacy)); err != nil {
+		t.Errorf("Check() rejected a bcrypt hash: %v", err)
+	}
+	if err := hasher.Check("wrong", string(legacy)); err != ErrPasswordMismatch {
+		t.Errorf("Check() error = %v, want %v", err, ErrPasswordMismatch)
+	}
+	if !hasher.NeedsRehash(string(legacy)) {
+		t.Error("NeedsRehash() = false for a bcrypt hash")
+	}
+
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("Hash() = %q, want an argon2id PHC string", hash)
+	}
+	if err := hasher.Check(password, hash); err != nil {
+		t.Errorf("Check() rejected its own hash: %v", err)
+	}
+	if err := hasher.Check("wrong", hash); err != ErrPasswordMismatch {
+		t.Errorf("Check() error = %v, want %v", err, ErrPasswordMismatch)
+	}
+	if hasher.NeedsRehash(hash) {
+		t.Error("NeedsRehash() = true for a current hash")
+	}
+
+	stronger := DefaultArgon2Params
+	stronger.Iterations = 3
+	if !NewPasswordHasher(stronger).NeedsRehash(hash) {
+		t.Error("NeedsRehash() = false after the parameters changed")
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// PersonalAccessTokenPrefix marks a bearer token as a personal access
+// token rather than a JWT, and makes leaked tokens easy to scan for.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+const (
+	ScopeChirpsRead    = "chirps:read"
+	ScopeChirpsWrite   = "chirps:write"
+	ScopeUsersRead     = "users:read"
+	ScopeUsersWrite    = "users:write"
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+)
+
+var validScopes = map[string]struct{}{
+	ScopeChirpsRead:    {},
+	ScopeChirpsWrite:   {},
+	ScopeUsersRead:     {},
+	ScopeUsersWrite:    {},
+	ScopeMessagesRead:  {},
+	ScopeMessagesWrite: {},
+}
+
+func MakePersonalAccessToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + hex.EncodeToString(raw), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// JoinScopes validates scopes and returns them space-separated, the way
+// they are stored. Duplicates are dropped.
+func JoinScopes(scopes []string) (string, error) {
+	if len(scopes) == 0 {
+		return "", fmt.Errorf("at least one scope is required")
+	}
+
+	seen := map[string]struct{}{}
+	joined := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if _, ok := validScopes[scope]; !ok {
+			return "", fmt.Errorf("unknown scope %q", scope)
+		}
+		if _, ok := seen[scope]; ok {
+			continue
+		}
+		seen[scope] = struct{}{}
+		joined = append(joined, scope)
+	}
+	return strings.Join(joined, " "), nil
+}
+
+// HasScope reports whether a space-separated scope list grants scope.
+func HasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
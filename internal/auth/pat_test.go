@@ -0,0 +1,49 @@
+package auth
+
+import "testing"
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() error = %v", err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("IsPersonalAccessToken(%q) = false", token)
+	}
+	if IsPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Error("IsPersonalAccessToken() accepted a JWT")
+	}
+}
+
+func TestJoinScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "single", scopes: []string{"chirps:read"}, want: "chirps:read"},
+		{name: "duplicates", scopes: []string{"chirps:write", "users:read", "chirps:write"}, want: "chirps:write users:read"},
+		{name: "empty", scopes: nil, wantErr: true},
+		{name: "unknown", scopes: []string{"chirps:read", "admin"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JoinScopes(tt.scopes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("JoinScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("JoinScopes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if !HasScope("chirps:read users:write", "users:write") {
+		t.Error("HasScope() missed a granted scope")
+	}
+	if HasScope("chirps:read", "chirps:write") {
+		t.Error("HasScope() granted a missing scope")
+	}
+}
@@ -0,0 +1,19 @@
+package auth
+
+import "testing"
+
+func TestVerifyPKCE(t *testing.T) {
+	// the example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("VerifyPKCE() rejected the RFC 7636 example")
+	}
+	if VerifyPKCE(verifier[:42]+"x", challenge) {
+		t.Error("VerifyPKCE() accepted the wrong verifier")
+	}
+	if VerifyPKCE("short", challenge) {
+		t.Error("VerifyPKCE() accepted a verifier under 43 characters")
+	}
+}
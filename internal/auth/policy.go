@@ -0,0 +1,88 @@
+package auth
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// maxPasswordLength keeps hashing cheap enough that huge passwords can't
+// be used to tie up the server. argon2id has no limit of its own; bcrypt
+// is only used to check hashes made before the switch, which were all
+// limited to its 72 bytes.
+const maxPasswordLength = 256
+
+const (
+	RuleMinLength      = "min_length"
+	RuleMaxLength      = "max_length"
+	RuleCommonPassword = "common_password"
+	RuleMatchesEmail   = "matches_email"
+)
+
+// PasswordPolicy decides which passwords users may choose.
+type PasswordPolicy struct {
+	MinLength       int
+	bannedPasswords map[string]struct{}
+}
+
+// PasswordRuleViolation describes one rule a password failed.
+type PasswordRuleViolation struct {
+	Rule    string
+	Message string
+}
+
+// NewPasswordPolicy returns a policy that requires minLength characters
+// and rejects the bundled list of common passwords.
+func NewPasswordPolicy(minLength int) PasswordPolicy {
+	banned := map[string]struct{}{}
+	for _, line := range strings.Split(commonPasswordsFile, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			banned[strings.ToLower(line)] = struct{}{}
+		}
+	}
+
+	return PasswordPolicy{
+		MinLength:       minLength,
+		bannedPasswords: banned,
+	}
+}
+
+// Check returns every rule the password breaks, or nil if it's acceptable.
+func (p PasswordPolicy) Check(password, email string) []PasswordRuleViolation {
+	var violations []PasswordRuleViolation
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, PasswordRuleViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters", p.MinLength),
+		})
+	}
+	if len(password) > maxPasswordLength {
+		violations = append(violations, PasswordRuleViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("Password must be at most %d bytes", maxPasswordLength),
+		})
+	}
+	if _, banned := p.bannedPasswords[strings.ToLower(password)]; banned {
+		violations = append(violations, PasswordRuleViolation{
+			Rule:    RuleCommonPassword,
+			Message: "Password is too common",
+		})
+	}
+
+	lowerPassword := strings.ToLower(password)
+	lowerEmail := strings.ToLower(email)
+	localPart, _, _ := strings.Cut(lowerEmail, "@")
+	if email != "" && (lowerPassword == lowerEmail || lowerPassword == localPart) {
+		violations = append(violations, PasswordRuleViolation{
+			Rule:    RuleMatchesEmail,
+			Message: "Password can't be your email",
+		})
+	}
+
+	return violations
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := NewPasswordPolicy(10)
+
+	tests := []struct {
+		name      string
+		password  string
+		email     string
+		wantRules []string
+	}{
+		{
+			name:      "Valid password",
+			password:  "correct horse battery",
+			email:     "bob@example.com",
+			wantRules: nil,
+		},
+		{
+			name:      "Empty password",
+			password:  "",
+			email:     "bob@example.com",
+			wantRules: []string{RuleMinLength},
+		},
+		{
+			name:      "Common password",
+			password:  "Password123",
+			email:     "bob@example.com",
+			wantRules: []string{RuleCommonPassword},
+		},
+		{
+			name:      "Password is the email",
+			password:  "Bob@Example.com",
+			email:     "bob@example.com",
+			wantRules: []string{RuleMatchesEmail},
+		},
+		{
+			name:      "Short and common",
+			password:  "qwerty",
+			email:     "bob@example.com",
+			wantRules: []string{RuleMinLength, RuleCommonPassword},
+		},
+		{
+			name:      "Longer than bcrypt allowed",
+			password:  strings.Repeat("correct horse battery ", 5),
+			email:     "bob@example.com",
+			wantRules: nil,
+		},
+		{
+			name:      "Too long",
+			password:  strings.Repeat("a", 257),
+			email:     "bob@example.com",
+			wantRules: []string{RuleMaxLength},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := policy.Check(tt.password, tt.email)
+			gotRules := []string{}
+			for _, v := range violations {
+				gotRules = append(gotRules, v.Rule)
+			}
+			if strings.Join(gotRules, ",") != strings.Join(tt.wantRules, ",") {
+				t.Errorf("Check() rules = %v, want %v", gotRules, tt.wantRules)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package auth
+
+import "testing"
+
+func TestRoleIncludes(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleModerator, true},
+		{RoleModerator, RoleUser, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleUser, RoleModerator, false},
+		{Role("superuser"), RoleUser, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.Includes(tt.required); got != tt.want {
+			t.Errorf("%q.Includes(%q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+
+	if _, err := ParseRole("superuser"); err == nil {
+		t.Error("ParseRole() accepted an unknown role")
+	}
+}
@@ -0,0 +1,20 @@
+package auth
+
+import "testing"
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if HashToken(token) != HashToken(token) {
+		t.Error("HashToken is not deterministic")
+	}
+	if HashToken(token) == token {
+		t.Error("HashToken returned the token unchanged")
+	}
+	if HashToken(token) == HashToken(token+"x") {
+		t.Error("different tokens hashed to the same value")
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1 key "12345678901234567890", last 6 digits
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcTOTPSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, _ := TOTPCode(secret, now)
+	previous, _ := TOTPCode(secret, now.Add(-30*time.Second))
+	stale, _ := TOTPCode(secret, now.Add(-5*time.Minute))
+
+	tests := []struct {
+		name   string
+		code   string
+		wantOK bool
+	}{
+		{name: "Current code", code: code, wantOK: true},
+		{name: "Previous step", code: previous, wantOK: true},
+		{name: "Stale code", code: stale, wantOK: stale == code || stale == previous},
+		{name: "Wrong length", code: "123", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(secret, tt.code, now); ok != tt.wantOK {
+				t.Errorf("ValidateTOTP() = %v, want %v", ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("got %d codes, want 10", len(codes))
+	}
+
+	seen := map[string]struct{}{}
+	for _, c := range codes {
+		if len(c) != 11 || !strings.Contains(c, "-") {
+			t.Errorf("malformed recovery code %q", c)
+		}
+		if _, dup := seen[c]; dup {
+			t.Errorf("duplicate recovery code %q", c)
+		}
+		seen[c] = struct{}{}
+	}
+}
@@ -7,6 +7,8 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -70,25 +72,53 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-ORDER BY created_at ASC
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, users.handle, users.display_name, users.avatar_url, users.is_chirpy_red FROM chirps
+JOIN users ON chirps.user_id = users.id
+WHERE (
+        users.is_protected = FALSE
+        OR users.id = $1
+        OR EXISTS (
+            SELECT 1 FROM follows
+            WHERE follows.followee_id = users.id
+                AND follows.follower_id = $1
+                AND follows.status = 'accepted'
+        )
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM mutes
+        WHERE mutes.muter_id = $1
+            AND mutes.muted_id = users.id
+    )
+ORDER BY chirps.created_at ASC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type GetChirpsRow struct {
+	Chirp       Chirp
+	Handle      sql.NullString
+	DisplayName string
+	AvatarURL   string
+	IsChirpyRed bool
+}
+
+func (q *Queries) GetChirps(ctx context.Context, viewerID uuid.UUID) ([]GetChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Chirp
+	var items []GetChirpsRow
 	for rows.Next() {
-		var i Chirp
+		var i GetChirpsRow
 		if err := rows.Scan(
-			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Body,
-			&i.UserID,
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Handle,
+			&i.DisplayName,
+			&i.AvatarURL,
+			&i.IsChirpyRed,
 		); err != nil {
 			return nil, err
 		}
@@ -104,13 +134,78 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsFromUserID = `-- name: GetChirpsFromUserID :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, users.handle, users.display_name, users.avatar_url, users.is_chirpy_red FROM chirps
+JOIN users ON chirps.user_id = users.id
+WHERE chirps.user_id = $1
+    AND (
+        users.is_protected = FALSE
+        OR users.id = $2
+        OR EXISTS (
+            SELECT 1 FROM follows
+            WHERE follows.followee_id = users.id
+                AND follows.follower_id = $2
+                AND follows.status = 'accepted'
+        )
+    )
+ORDER BY chirps.created_at ASC
+`
+
+type GetChirpsFromUserIDParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+}
+
+type GetChirpsFromUserIDRow struct {
+	Chirp       Chirp
+	Handle      sql.NullString
+	DisplayName string
+	AvatarURL   string
+	IsChirpyRed bool
+}
+
+func (q *Queries) GetChirpsFromUserID(ctx context.Context, arg GetChirpsFromUserIDParams) ([]GetChirpsFromUserIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsFromUserID, arg.UserID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpsFromUserIDRow
+	for rows.Next() {
+		var i GetChirpsFromUserIDRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Handle,
+			&i.DisplayName,
+			&i.AvatarURL,
+			&i.IsChirpyRed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPublicChirpsSince = `-- name: GetPublicChirpsSince :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id FROM chirps
+JOIN users ON chirps.user_id = users.id
+WHERE chirps.created_at > $1
+    AND users.is_protected = FALSE
+ORDER BY chirps.created_at DESC
 `
 
-func (q *Queries) GetChirpsFromUserID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsFromUserID, userID)
+func (q *Queries) GetPublicChirpsSince(ctx context.Context, createdAt time.Time) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getPublicChirpsSince, createdAt)
 	if err != nil {
 		return nil, err
 	}
@@ -137,3 +232,49 @@ func (q *Queries) GetChirpsFromUserID(ctx context.Context, userID uuid.UUID) ([]
 	}
 	return items, nil
 }
+
+const getVisibleChirp = `-- name: GetVisibleChirp :one
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, users.handle, users.display_name, users.avatar_url, users.is_chirpy_red FROM chirps
+JOIN users ON chirps.user_id = users.id
+WHERE chirps.id = $1
+    AND (
+        users.is_protected = FALSE
+        OR users.id = $2
+        OR EXISTS (
+            SELECT 1 FROM follows
+            WHERE follows.followee_id = users.id
+                AND follows.follower_id = $2
+                AND follows.status = 'accepted'
+        )
+    )
+`
+
+type GetVisibleChirpParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.UUID
+}
+
+type GetVisibleChirpRow struct {
+	Chirp       Chirp
+	Handle      sql.NullString
+	DisplayName string
+	AvatarURL   string
+	IsChirpyRed bool
+}
+
+func (q *Queries) GetVisibleChirp(ctx context.Context, arg GetVisibleChirpParams) (GetVisibleChirpRow, error) {
+	row := q.db.QueryRowContext(ctx, getVisibleChirp, arg.ID, arg.ViewerID)
+	var i GetVisibleChirpRow
+	err := row.Scan(
+		&i.Chirp.ID,
+		&i.Chirp.CreatedAt,
+		&i.Chirp.UpdatedAt,
+		&i.Chirp.Body,
+		&i.Chirp.UserID,
+		&i.Handle,
+		&i.DisplayName,
+		&i.AvatarURL,
+		&i.IsChirpyRed,
+	)
+	return i, err
+}
@@ -11,6 +11,23 @@ import (
 	"github.com/google/uuid"
 )
 
+type AuditEvent struct {
+	ID        uuid.UUID
+	EventType string
+	ActorID   uuid.NullUUID
+	TargetID  uuid.NullUUID
+	IpAddress string
+	RequestID string
+	Details   string
+	CreatedAt time.Time
+}
+
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
@@ -19,20 +36,230 @@ type Chirp struct {
 	UserID    uuid.UUID
 }
 
-type RefreshToken struct {
-	Token     string
+type Conversation struct {
+	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+}
+
+type ConversationMember struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	JoinedAt       time.Time
+	LastReadAt     sql.NullTime
+}
+
+type DeniedToken struct {
+	Jti       string
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	CreatedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
 	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	Email     string
 }
 
-type User struct {
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	Status     string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type Invite struct {
+	ID            uuid.UUID
+	CodeHash      string
+	InviterID     uuid.UUID
+	BatchID       uuid.NullUUID
+	MaxUses       int32
+	UsesRemaining int32
+	ExpiresAt     sql.NullTime
+	CreatedAt     time.Time
+}
+
+type InviteRedemption struct {
+	InviteID   uuid.UUID
+	UserID     uuid.UUID
+	RedeemedAt time.Time
+}
+
+type LockoutEvent struct {
+	ID          uuid.UUID
+	Scope       string
+	Subject     string
+	Failures    int32
+	IpAddress   string
+	CreatedAt   time.Time
+	LockedUntil time.Time
+}
+
+type LoginThrottle struct {
+	Scope         string
+	Subject       string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type MagicLinkRequest struct {
+	Email     string
+	CreatedAt time.Time
+}
+
+type MagicLinkToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	NonceHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	Email     string
+}
+
+type Message struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	Body           string
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+}
+
+type Mute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        string
+	CodeChallenge string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+	FamilyID      uuid.NullUUID
+}
+
+type OauthClient struct {
+	ID               uuid.UUID
+	OwnerID          uuid.UUID
+	Name             string
+	RedirectUris     string
+	SecretHash       sql.NullString
+	CreatedAt        time.Time
+	IsResourceServer bool
+}
+
+type OauthGrant struct {
+	UserID    uuid.UUID
+	ClientID  uuid.UUID
+	Scopes    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	UserID       uuid.NullUUID
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+type PasswordResetRequest struct {
+	Email     string
+	CreatedAt time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash       string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	ExpiresAt       time.Time
+	RevokedAt       sql.NullTime
+	UserID          uuid.UUID
+	FamilyID        uuid.UUID
+	RotatedAt       sql.NullTime
+	UserAgent       string
+	IpAddress       string
+	LastUsedAt      time.Time
+	AccessJti       sql.NullString
+	AccessExpiresAt sql.NullTime
+	ClientID        uuid.NullUUID
+}
+
+type User struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  sql.NullString
+	IsChirpyRed     bool
+	IsProtected     bool
+	Handle          sql.NullString
+	DisplayName     string
+	Bio             string
+	AvatarURL       string
+	HandleUpdatedAt sql.NullTime
+	EmailVerifiedAt sql.NullTime
+	TotpSecret      sql.NullString
+	TotpEnabledAt   sql.NullTime
+	TotpLastStep    int64
+	Role            string
+}
+
+type UserIdentity struct {
+	Provider    string
+	Subject     string
+	UserID      uuid.UUID
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt sql.NullTime
+}
+
+type UserSuggestion struct {
+	UserID          uuid.UUID
+	SuggestedUserID uuid.UUID
+	Score           int32
+	Reason          string
+	CreatedAt       time.Time
 }
@@ -7,90 +7,269 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, expires_at, revoked_at, user_id)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id, user_agent, ip_address, last_used_at, access_jti, access_expires_at, client_id)
 VALUES (
     $1,
     NOW(),
     NOW(),
     NOW() + INTERVAL '60 days',
     NULL,
-    $2
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW(),
+    $6,
+    NOW() + $7::int * INTERVAL '1 second',
+    $8
 )
-RETURNING token, created_at, updated_at, expires_at, revoked_at, user_id
+RETURNING token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id, rotated_at, user_agent, ip_address, last_used_at, access_jti, access_expires_at, client_id
 `
 
 type CreateRefreshTokenParams struct {
-	Token  string
-	UserID uuid.UUID
+	TokenHash        string
+	UserID           uuid.UUID
+	FamilyID         uuid.UUID
+	UserAgent        string
+	IpAddress        string
+	AccessJti        sql.NullString
+	AccessTtlSeconds int32
+	ClientID         uuid.NullUUID
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.AccessJti,
+		arg.AccessTtlSeconds,
+		arg.ClientID,
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpiresAt,
 		&i.RevokedAt,
 		&i.UserID,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.AccessJti,
+		&i.AccessExpiresAt,
+		&i.ClientID,
 	)
 	return i, err
 }
 
 const getRefreshToken = `-- name: GetRefreshToken :one
-SELECT token, created_at, updated_at, expires_at, revoked_at, user_id FROM refresh_tokens
-WHERE token = $1
+SELECT token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id, rotated_at, user_agent, ip_address, last_used_at, access_jti, access_expires_at, client_id FROM refresh_tokens
+WHERE token_hash = $1
 `
 
-func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, getRefreshToken, token)
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpiresAt,
 		&i.RevokedAt,
 		&i.UserID,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.AccessJti,
+		&i.AccessExpiresAt,
+		&i.ClientID,
 	)
 	return i, err
 }
 
-const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red FROM users 
-JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
-    AND refresh_tokens.expires_at > NOW()
-    AND refresh_tokens.revoked_at IS NULL
+const getRefreshTokenForUpdate = `-- name: GetRefreshTokenForUpdate :one
+SELECT token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id, rotated_at, user_agent, ip_address, last_used_at, access_jti, access_expires_at, client_id FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE
 `
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
-	var i User
+func (q *Queries) GetRefreshTokenForUpdate(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenForUpdate, tokenHash)
+	var i RefreshToken
 	err := row.Scan(
-		&i.ID,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.Email,
-		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.UserID,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.AccessJti,
+		&i.AccessExpiresAt,
+		&i.ClientID,
 	)
 	return i, err
 }
 
+const getUserSessions = `-- name: GetUserSessions :many
+SELECT
+    family_id,
+    user_agent,
+    ip_address,
+    (
+        SELECT MIN(family.created_at) FROM refresh_tokens family
+        WHERE family.family_id = refresh_tokens.family_id
+    )::timestamp AS started_at,
+    last_used_at,
+    expires_at
+FROM refresh_tokens
+WHERE user_id = $1
+    AND client_id IS NULL
+    AND rotated_at IS NULL
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+ORDER BY last_used_at DESC
+`
+
+type GetUserSessionsRow struct {
+	FamilyID   uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	StartedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+func (q *Queries) GetUserSessions(ctx context.Context, userID uuid.UUID) ([]GetUserSessionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserSessionsRow
+	for rows.Next() {
+		var i GetUserSessionsRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.StartedAt,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1
+WHERE token_hash = $1
+`
+
+func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, tokenHash)
+	return err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeUserClientRefreshTokens = `-- name: RevokeUserClientRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND client_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeUserClientRefreshTokensParams struct {
+	UserID   uuid.UUID
+	ClientID uuid.NullUUID
+}
+
+func (q *Queries) RevokeUserClientRefreshTokens(ctx context.Context, arg RevokeUserClientRefreshTokensParams) error {
+	_, err := q.db.ExecContext(ctx, revokeUserClientRefreshTokens, arg.UserID, arg.ClientID)
+	return err
+}
+
+const revokeUserRefreshTokenFamily = `-- name: RevokeUserRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeUserRefreshTokenFamilyParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeUserRefreshTokenFamily(ctx context.Context, arg RevokeUserRefreshTokenFamilyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeUserRefreshTokenFamily, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeUserRefreshTokens = `-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
+func (q *Queries) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserRefreshTokens, userID)
 	return err
 }
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET rotated_at = NOW(), last_used_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1
+    AND rotated_at IS NULL
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+`
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, tokenHash string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rotateRefreshToken, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -7,10 +7,23 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const countAdmins = `-- name: CountAdmins :one
+SELECT COUNT(*) FROM users
+WHERE role = 'admin'
+`
+
+func (q *Queries) CountAdmins(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countAdmins)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
@@ -20,12 +33,12 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
 `
 
 type CreateUserParams struct {
 	Email          string
-	HashedPassword string
+	HashedPassword sql.NullString
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
@@ -38,13 +51,88 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const disableUserTotp = `-- name: DisableUserTotp :one
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
+`
+
+func (q *Queries) DisableUserTotp(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, disableUserTotp, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const enableUserTotp = `-- name: EnableUserTotp :one
+UPDATE users
+SET totp_enabled_at = NOW(), updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
+`
+
+func (q *Queries) EnableUserTotp(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, enableUserTotp, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
-WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role FROM users
+WHERE LOWER(email) = LOWER($1)
 `
 
 func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
@@ -57,6 +145,108 @@ func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role FROM users
+WHERE LOWER(handle) = LOWER($1::text)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const getUserByIDForUpdate = `-- name: GetUserByIDForUpdate :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role FROM users
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetUserByIDForUpdate(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByIDForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
 	)
 	return i, err
 }
@@ -70,16 +260,130 @@ func (q *Queries) ResetUsers(ctx context.Context) error {
 	return err
 }
 
+const setUserProtected = `-- name: SetUserProtected :one
+UPDATE users
+SET is_protected = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
+`
+
+type SetUserProtectedParams struct {
+	IsProtected bool
+	ID          uuid.UUID
+}
+
+func (q *Queries) SetUserProtected(ctx context.Context, arg SetUserProtectedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserProtected, arg.IsProtected, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET role = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
+`
+
+type SetUserRoleParams struct {
+	Role string
+	ID   uuid.UUID
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.Role, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const setUserTotpSecret = `-- name: SetUserTotpSecret :one
+UPDATE users
+SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
+`
+
+type SetUserTotpSecretParams struct {
+	TotpSecret sql.NullString
+	ID         uuid.UUID
+}
+
+func (q *Queries) SetUserTotpSecret(ctx context.Context, arg SetUserTotpSecretParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserTotpSecret, arg.TotpSecret, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
+SET email = $1,
+    hashed_password = $2,
+    email_verified_at = CASE WHEN LOWER(email) = LOWER($1) THEN email_verified_at ELSE NULL END,
+    updated_at = NOW()
 WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
 `
 
 type UpdateUserParams struct {
 	Email          string
-	HashedPassword string
+	HashedPassword sql.NullString
 	ID             uuid.UUID
 }
 
@@ -93,15 +397,181 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
+UPDATE users
+SET email = $1,
+    email_verified_at = CASE WHEN LOWER(email) = LOWER($1) THEN email_verified_at ELSE NULL END,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
+`
+
+type UpdateUserEmailParams struct {
+	Email string
+	ID    uuid.UUID
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserEmail, arg.Email, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
 	)
 	return i, err
 }
 
+const updateUserHandle = `-- name: UpdateUserHandle :one
+UPDATE users
+SET handle = $1, handle_updated_at = NOW(), updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
+`
+
+type UpdateUserHandleParams struct {
+	Handle sql.NullString
+	ID     uuid.UUID
+}
+
+func (q *Queries) UpdateUserHandle(ctx context.Context, arg UpdateUserHandleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserHandle, arg.Handle, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2
+`
+
+type UpdateUserPasswordParams struct {
+	HashedPassword sql.NullString
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.HashedPassword, arg.ID)
+	return err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET display_name = $1, bio = $2, avatar_url = $3, updated_at = NOW()
+WHERE id = $4
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
+`
+
+type UpdateUserProfileParams struct {
+	DisplayName string
+	Bio         string
+	AvatarURL   string
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarURL,
+		arg.ID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const updateUserTotpLastStep = `-- name: UpdateUserTotpLastStep :execrows
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2 AND totp_last_step < $1
+`
+
+type UpdateUserTotpLastStepParams struct {
+	TotpLastStep int64
+	ID           uuid.UUID
+}
+
+func (q *Queries) UpdateUserTotpLastStep(ctx context.Context, arg UpdateUserTotpLastStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateUserTotpLastStep, arg.TotpLastStep, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const upgradeUserToChirpyRed = `-- name: UpgradeUserToChirpyRed :one
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
 `
 
 func (q *Queries) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (User, error) {
@@ -114,6 +584,49 @@ func (q *Queries) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (Use
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+	)
+	return i, err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_protected, handle, display_name, bio, avatar_url, handle_updated_at, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role
+`
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsProtected,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.HandleUpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
 	)
 	return i, err
 }
@@ -0,0 +1,27 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// LogMailer writes emails to w instead of sending them. It's meant for
+// local development, where w is stdout or a file.
+type LogMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{w: w}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "To: %s\nSubject: %s\n\n%s\n----\n", msg.To, msg.Subject, msg.Body)
+	return err
+}
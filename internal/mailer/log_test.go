@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLogMailerSend(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer(&buf)
+
+	err := m.Send(context.Background(), Message{
+		To:      "bob@example.com",
+		Subject: "Verify your email",
+		Body:    "token: abc123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{"To: bob@example.com", "Subject: Verify your email", "token: abc123"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output %q doesn't contain %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "chirpy"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "http://localhost:8080/api/login/oidc/mock/callback"
+	// an RFC 7636 verifier and its S256 challenge
+	testVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+// mockIdP is a minimal OpenID Connect provider. Every code it accepts
+// yields an ID token built from claims, signed with key.
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	claims jwt.MapClaims
+	// challenge is the code_challenge of the one outstanding code
+	challenge string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, kid: "key-1", challenge: testChallenge}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": idp.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(rw http.ResponseWriter, req *http.Request) {
+		id, secret, ok := req.BasicAuth()
+		if !ok || id != testClientID || secret != testClientSecret {
+			rw.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		sum := sha256.Sum256([]byte(req.PostFormValue("code_verifier")))
+		if req.PostFormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			rw.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		token.Header["kid"] = idp.kid
+		signed, err := token.SignedString(idp.key)
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(rw).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	now := time.Now()
+	idp.claims = jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            "user-123",
+		"aud":            testClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          "n-0S6_WzA2Mj",
+		"email":          "ada@example.com",
+		"email_verified": true,
+	}
+	return idp
+}
+
+func (idp *mockIdP) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "mock",
+		Issuer:       idp.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, idp.server.Client())
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newMockIdP(t)
+
+	got, err := idp.provider().AuthCodeURL(context.Background(), "state-1", "nonce-1", testChallenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, idp.server.URL+"/authorize?") {
+		t.Errorf("AuthCodeURL() = %q, want the discovered authorization endpoint", got)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        testChallenge,
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if u.Query().Get(key) != value {
+			t.Errorf("AuthCodeURL() %s = %q, want %q", key, u.Query().Get(key), value)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		nonce   string
+		claims  jwt.MapClaims
+		wantErr error
+	}{
+		{name: "valid", code: "good-code", nonce: "n-0S6_WzA2Mj"},
+		{name: "wrong nonce", code: "good-code", nonce: "replayed", wantErr: ErrNonceMismatch},
+		{name: "wrong audience", code: "good-code", nonce: "n-0S6_WzA2Mj", claims: jwt.MapClaims{"aud": "someone-else"}, wantErr: ErrInvalidIDToken},
+		{name: "wrong issuer", code: "good-code", nonce: "n-0S6_WzA2Mj", claims: jwt.MapClaims{"iss": "https://evil.example.com"}, wantErr: ErrInvalidIDToken},
+		{name: "expired", code: "good-code", nonce: "n-0S6_WzA2Mj", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, wantErr: ErrInvalidIDToken},
+		{name: "another azp", code: "good-code", nonce: "n-0S6_WzA2Mj", claims: jwt.MapClaims{"aud": []string{testClientID, "other"}, "azp": "other"}, wantErr: ErrInvalidIDToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			for key, value := range tt.claims {
+				idp.claims[key] = value
+			}
+
+			identity, err := idp.provider().Exchange(context.Background(), tt.code, testVerifier, tt.nonce)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Exchange() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			want := Identity{Subject: "user-123", Email: "ada@example.com", EmailVerified: true}
+			if identity != want {
+				t.Errorf("Exchange() = %+v, want %+v", identity, want)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	idp := newMockIdP(t)
+
+	_, err := idp.provider().Exchange(context.Background(), "good-code", strings.Repeat("a", 43), "n-0S6_WzA2Mj")
+	if err == nil {
+		t.Fatal("Exchange() accepted a code with the wrong code_verifier")
+	}
+}
+
+func TestExchangeForgedSignature(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+	if _, err := p.Exchange(context.Background(), "good-code", testVerifier, "n-0S6_WzA2Mj"); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	// a different key under the known kid must not verify
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.key = forger
+	_, err = p.Exchange(context.Background(), "good-code", testVerifier, "n-0S6_WzA2Mj")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Exchange() error = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestExchangeKeyRotation(t *testing.T) {
+	idp := newMockIdP(t)
+	p := idp.provider()
+	if _, err := p.Exchange(context.Background(), "good-code", testVerifier, "n-0S6_WzA2Mj"); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	// the provider rotates to a new key; allow an immediate refetch
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.key, idp.kid = newKey, "key-2"
+	p.keysFetchedAt = time.Time{}
+
+	if _, err := p.Exchange(context.Background(), "good-code", testVerifier, "n-0S6_WzA2Mj"); err != nil {
+		t.Errorf("Exchange() after rotation error = %v", err)
+	}
+}
+
+func TestEmailVerifiedAsString(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.claims["email_verified"] = "true"
+
+	identity, err := idp.provider().Exchange(context.Background(), "good-code", testVerifier, "n-0S6_WzA2Mj")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if !identity.EmailVerified {
+		t.Error("Exchange() EmailVerified = false for \"true\"")
+	}
+}
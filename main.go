@@ -1,23 +1,40 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
+	"github.com/bencuci/chirpy/internal/auth"
 	"github.com/bencuci/chirpy/internal/database"
+	"github.com/bencuci/chirpy/internal/mailer"
+	"github.com/bencuci/chirpy/internal/oidc"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db             *sql.DB
 	dbQueries      *database.Queries
 	platform       string
-	secret         string
+	jwtKeys        *auth.KeySet
 	polkaKey       string
+	mailer         mailer.Mailer
+	passwordPolicy auth.PasswordPolicy
+	passwordHasher *auth.PasswordHasher
+	denylist       *auth.Denylist
+	oidcProviders  map[string]*oidc.Provider
+	baseURL        string
+	inviteOnly     bool
+	inviteQuota    int
 }
 
 func main() {
@@ -38,8 +55,66 @@ func main() {
 		log.Fatal("POLKA_KEY environment variable is not set")
 	}
 	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	var jwtKeys *auth.KeySet
+	if jwtKeysDir := os.Getenv("JWT_KEYS_DIR"); jwtKeysDir != "" {
+		keys, err := auth.LoadKeySet(jwtKeysDir, os.Getenv("JWT_SIGNING_KID"))
+		if err != nil {
+			log.Fatalf("Error loading JWT keys: %v", err)
+		}
+		// keep accepting HS256 tokens issued before the switch
+		if jwtSecret != "" {
+			keys.AddHMAC(jwtSecret)
+		}
+		jwtKeys = keys
+	} else if jwtSecret != "" {
+		jwtKeys = auth.NewHMACKeySet(jwtSecret)
+	} else {
+		log.Fatal("JWT_SECRET or JWT_KEYS_DIR must be set")
+	}
+
+	passwordMinLength := positiveIntFromEnv("PASSWORD_MIN_LENGTH", 8)
+
+	inviteOnly := false
+	if v := os.Getenv("INVITE_ONLY"); v != "" {
+		var err error
+		if inviteOnly, err = strconv.ParseBool(v); err != nil {
+			log.Fatal("INVITE_ONLY must be true or false")
+		}
+	}
+	inviteQuota := intFromEnv("INVITE_QUOTA", 5, 0)
+
+	argon2Params := auth.DefaultArgon2Params
+	argon2Params.MemoryKiB = uint32(positiveIntFromEnv("ARGON2_MEMORY_KIB", int(argon2Params.MemoryKiB)))
+	argon2Params.Iterations = uint32(positiveIntFromEnv("ARGON2_ITERATIONS", int(argon2Params.Iterations)))
+	argon2Params.Parallelism = uint8(min(positiveIntFromEnv("ARGON2_PARALLELISM", int(argon2Params.Parallelism)), 255))
+
+	baseURL := strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
+	oidcProviders := oidcProvidersFromEnv(baseURL)
+
+	var mail mailer.Mailer
+	if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "587"
+		}
+		mailFrom := os.Getenv("MAIL_FROM")
+		if mailFrom == "" {
+			log.Fatal("MAIL_FROM must be set when SMTP_HOST is set")
+		}
+		mail = mailer.NewSMTPMailer(smtpHost, smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom)
+	} else if mailLogFile := os.Getenv("MAIL_LOG_FILE"); mailLogFile != "" {
+		f, err := os.OpenFile(mailLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatalf("Error opening the mail log file: %v", err)
+		}
+		defer f.Close()
+		mail = mailer.NewLogMailer(f)
+	} else {
+		log.Println("SMTP_HOST is not set, emails will be printed to stdout")
+		mail = mailer.NewLogMailer(os.Stdout)
 	}
 
 	db, err := sql.Open("postgres", dbURL)
@@ -47,14 +122,40 @@ func main() {
 		log.Fatalf("Error opening the database: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap-admin" {
+		if len(os.Args) != 3 {
+			log.Fatal("usage: chirpy bootstrap-admin <email>")
+		}
+		if err := bootstrapAdmin(context.Background(), db, os.Args[2]); err != nil {
+			log.Fatalf("Error granting admin: %v", err)
+		}
+		log.Printf("%s is now an admin", os.Args[2])
+		return
+	}
+
+	denylist := auth.NewDenylist()
+	jwtKeys.UseDenylist(denylist)
+
 	var apiCfg = apiConfig{
 		fileserverHits: atomic.Int32{},
+		db:             db,
 		dbQueries:      database.New(db),
 		platform:       platform,
-		secret:         jwtSecret,
+		jwtKeys:        jwtKeys,
 		polkaKey:       polkaKey,
+		mailer:         mail,
+		passwordPolicy: auth.NewPasswordPolicy(passwordMinLength),
+		passwordHasher: auth.NewPasswordHasher(argon2Params),
+		denylist:       denylist,
+		oidcProviders:  oidcProviders,
+		baseURL:        baseURL,
+		inviteOnly:     inviteOnly,
+		inviteQuota:    inviteQuota,
 	}
 
+	go apiCfg.runSuggestionsJob(context.Background(), suggestionsInterval)
+	go apiCfg.runDenylistSync(context.Background(), denylistSyncInterval)
+
 	mux := http.NewServeMux()
 	handler := http.FileServer(http.Dir(rootPath))
 	mux.Handle("/app/", http.StripPrefix("/app", apiCfg.middlewareMetricsInc(handler)))
@@ -63,27 +164,147 @@ func main() {
 
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerUpgradeMembership)
 
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
+
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/2fa", apiCfg.handlerLoginTwoFactor)
+	mux.HandleFunc("POST /api/login/magic", apiCfg.handlerRequestMagicLink)
+	mux.HandleFunc("POST /api/login/magic/verify", apiCfg.handlerVerifyMagicLink)
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefreshToken)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevokeRefreshToken)
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.handlerForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.handlerResetPassword)
+
+	mux.HandleFunc("GET /api/login/oidc", apiCfg.handlerGetOIDCProviders)
+	mux.HandleFunc("GET /api/login/oidc/{provider}", apiCfg.handlerOIDCLogin)
+	mux.HandleFunc("GET /api/login/oidc/{provider}/callback", apiCfg.handlerOIDCCallback)
+
+	mux.HandleFunc("GET /api/oauth/authorize", apiCfg.handlerAuthorize)
+	mux.HandleFunc("POST /api/oauth/authorize", apiCfg.handlerAuthorizeDecision)
+	mux.HandleFunc("POST /api/oauth/token", apiCfg.handlerOAuthToken)
+	mux.HandleFunc("POST /api/oauth/introspect", apiCfg.handlerIntrospect)
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.handlerCreateOAuthClient)
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.handlerGetOAuthClients)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.handlerDeleteOAuthClient)
 
 	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
 	mux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
+	mux.HandleFunc("PATCH /api/users/me", apiCfg.handlerPatchUser)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.handlerResendVerification)
+
+	mux.HandleFunc("GET /api/users/{idOrHandle}", apiCfg.handlerGetUserProfile)
+	mux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.handlerFollowUser)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.handlerUnfollowUser)
+	mux.HandleFunc("POST /api/users/{userID}/block", apiCfg.handlerBlockUser)
+	mux.HandleFunc("DELETE /api/users/{userID}/block", apiCfg.handlerUnblockUser)
+	mux.HandleFunc("POST /api/users/{userID}/mute", apiCfg.handlerMuteUser)
+	mux.HandleFunc("DELETE /api/users/{userID}/mute", apiCfg.handlerUnmuteUser)
+	mux.HandleFunc("POST /api/users/me/2fa/totp", apiCfg.handlerEnrollTOTP)
+	mux.HandleFunc("POST /api/users/me/2fa/totp/confirm", apiCfg.handlerConfirmTOTP)
+	mux.HandleFunc("DELETE /api/users/me/2fa/totp", apiCfg.handlerDisableTOTP)
+	mux.HandleFunc("POST /api/users/me/tokens", apiCfg.handlerCreatePersonalAccessToken)
+	mux.HandleFunc("GET /api/users/me/tokens", apiCfg.handlerGetPersonalAccessTokens)
+	mux.HandleFunc("DELETE /api/users/me/tokens/{tokenID}", apiCfg.handlerRevokePersonalAccessToken)
+	mux.HandleFunc("GET /api/users/me/sessions", apiCfg.handlerGetSessions)
+	mux.HandleFunc("DELETE /api/users/me/sessions", apiCfg.handlerRevokeAllSessions)
+	mux.HandleFunc("DELETE /api/users/me/sessions/{sessionID}", apiCfg.handlerRevokeSession)
+	mux.HandleFunc("GET /api/users/me/security-events", apiCfg.handlerGetSecurityEvents)
+	mux.HandleFunc("GET /api/users/me/identities", apiCfg.handlerGetIdentities)
+	mux.HandleFunc("POST /api/users/me/identities/{provider}", apiCfg.handlerLinkIdentity)
+	mux.HandleFunc("DELETE /api/users/me/identities/{provider}", apiCfg.handlerUnlinkIdentity)
+	mux.HandleFunc("POST /api/users/me/invites", apiCfg.handlerCreateUserInvite)
+	mux.HandleFunc("GET /api/users/me/invites", apiCfg.handlerGetUserInvites)
+	mux.HandleFunc("GET /api/users/me/apps", apiCfg.handlerGetAuthorizedApps)
+	mux.HandleFunc("DELETE /api/users/me/apps/{clientID}", apiCfg.handlerRevokeAuthorizedApp)
+	mux.HandleFunc("GET /api/users/me/suggestions", apiCfg.handlerGetSuggestions)
+	mux.HandleFunc("GET /api/users/me/blocks", apiCfg.handlerGetBlocks)
+	mux.HandleFunc("GET /api/users/me/mutes", apiCfg.handlerGetMutes)
+	mux.HandleFunc("GET /api/users/me/follow_requests", apiCfg.handlerGetFollowRequests)
+	mux.HandleFunc("POST /api/users/me/follow_requests/{followerID}", apiCfg.handlerApproveFollowRequest)
+	mux.HandleFunc("DELETE /api/users/me/follow_requests/{followerID}", apiCfg.handlerDenyFollowRequest)
 
 	mux.HandleFunc("POST /api/chirps", apiCfg.handlerPostChirp)
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirp)
 
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerResetVisiterCount)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerVisiterCount)
+	mux.HandleFunc("POST /api/conversations", apiCfg.handlerCreateConversation)
+	mux.HandleFunc("GET /api/conversations", apiCfg.handlerGetConversations)
+	mux.HandleFunc("POST /api/conversations/{conversationID}/messages", apiCfg.handlerPostMessage)
+	mux.HandleFunc("GET /api/conversations/{conversationID}/messages", apiCfg.handlerGetMessages)
+	mux.HandleFunc("POST /api/conversations/{conversationID}/read", apiCfg.handlerReadConversation)
+
+	mux.HandleFunc("POST /admin/reset", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerResetVisiterCount))
+	mux.HandleFunc("GET /admin/metrics", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerVisiterCount))
+	mux.HandleFunc("GET /admin/lockouts", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerGetLockouts))
+	mux.HandleFunc("DELETE /admin/lockouts/{scope}/{subject}", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerUnlockLogin))
+	mux.HandleFunc("GET /admin/audit-events", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerGetAuditEvents))
+	mux.HandleFunc("PUT /admin/users/{userID}/role", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerSetUserRole))
+	mux.HandleFunc("POST /admin/invites", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerCreateInvites))
+	mux.HandleFunc("PUT /admin/oauth/clients/{clientID}/resource-server", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerSetResourceServer))
+	mux.HandleFunc("DELETE /admin/chirps/{chirpID}", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerRemoveChirp))
 
 	server := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: middlewareRequestID(middlewareCSRF(mux)),
 	}
 
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
 }
+
+// positiveIntFromEnv reads an optional numeric setting, exiting if it is
+// set to anything but a positive number.
+func positiveIntFromEnv(name string, fallback int) int {
+	return intFromEnv(name, fallback, 1)
+}
+
+// intFromEnv reads an optional numeric setting, exiting if it is set to
+// anything but a number of at least atLeast.
+func intFromEnv(name string, fallback, atLeast int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < atLeast {
+		log.Fatalf("%s must be a number of at least %d", name, atLeast)
+	}
+	return n
+}
+
+var providerNameRegexp = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// oidcProvidersFromEnv reads the providers named in OIDC_PROVIDERS, each
+// configured by OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and the
+// optional _SCOPES. Public clients leave the secret out.
+func oidcProvidersFromEnv(baseURL string) map[string]*oidc.Provider {
+	client := &http.Client{Timeout: 10 * time.Second}
+	providers := map[string]*oidc.Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !providerNameRegexp.MatchString(name) {
+			log.Fatalf("OIDC provider name %q must be lowercase letters, digits or dashes", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		cfg := oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  baseURL + "/api/login/oidc/" + name + "/callback",
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			log.Fatalf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		providers[name] = oidc.NewProvider(cfg, client)
+	}
+	return providers
+}
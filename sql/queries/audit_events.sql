@@ -0,0 +1,27 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (id, event_type, actor_id, target_id, ip_address, request_id, details, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW()
+);
+
+-- name: GetUserAuditEvents :many
+SELECT * FROM audit_events
+WHERE actor_id = sqlc.arg(user_id) OR target_id = sqlc.arg(user_id)
+ORDER BY created_at DESC
+LIMIT sqlc.arg(max_events)::int;
+
+-- name: GetAuditEvents :many
+SELECT * FROM audit_events
+WHERE (sqlc.narg(event_type)::text IS NULL OR event_type = sqlc.narg(event_type))
+    AND (sqlc.narg(actor_id)::uuid IS NULL OR actor_id = sqlc.narg(actor_id))
+    AND (sqlc.narg(target_id)::uuid IS NULL OR target_id = sqlc.narg(target_id))
+    AND (sqlc.narg(before)::timestamp IS NULL OR created_at < sqlc.narg(before))
+ORDER BY created_at DESC
+LIMIT sqlc.arg(max_events)::int;
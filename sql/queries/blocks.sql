@@ -0,0 +1,33 @@
+-- name: CreateBlock :exec
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING;
+
+-- name: DeleteBlock :exec
+DELETE FROM blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: GetBlocks :many
+SELECT * FROM blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC;
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_id = sqlc.arg(user_a) AND blocked_id = sqlc.arg(user_b))
+        OR (blocker_id = sqlc.arg(user_b) AND blocked_id = sqlc.arg(user_a))
+);
+
+-- name: ConversationHasBlock :one
+SELECT EXISTS (
+    SELECT 1 FROM conversation_members
+    JOIN blocks ON (blocks.blocker_id = conversation_members.user_id AND blocks.blocked_id = sqlc.arg(user_id))
+        OR (blocks.blocker_id = sqlc.arg(user_id) AND blocks.blocked_id = conversation_members.user_id)
+    WHERE conversation_members.conversation_id = sqlc.arg(conversation_id)
+);
+
+-- name: DeleteFollowsBetween :exec
+DELETE FROM follows
+WHERE (follower_id = sqlc.arg(user_a) AND followee_id = sqlc.arg(user_b))
+    OR (follower_id = sqlc.arg(user_b) AND followee_id = sqlc.arg(user_a));
@@ -10,18 +10,67 @@ VALUES (
 RETURNING *;
 
 -- name: GetChirps :many
-SELECT * FROM chirps
-ORDER BY created_at ASC;
+SELECT sqlc.embed(chirps), users.handle, users.display_name, users.avatar_url, users.is_chirpy_red FROM chirps
+JOIN users ON chirps.user_id = users.id
+WHERE (
+        users.is_protected = FALSE
+        OR users.id = sqlc.arg(viewer_id)
+        OR EXISTS (
+            SELECT 1 FROM follows
+            WHERE follows.followee_id = users.id
+                AND follows.follower_id = sqlc.arg(viewer_id)
+                AND follows.status = 'accepted'
+        )
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM mutes
+        WHERE mutes.muter_id = sqlc.arg(viewer_id)
+            AND mutes.muted_id = users.id
+    )
+ORDER BY chirps.created_at ASC;
 
 -- name: GetChirpsFromUserID :many
-SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
+SELECT sqlc.embed(chirps), users.handle, users.display_name, users.avatar_url, users.is_chirpy_red FROM chirps
+JOIN users ON chirps.user_id = users.id
+WHERE chirps.user_id = sqlc.arg(user_id)
+    AND (
+        users.is_protected = FALSE
+        OR users.id = sqlc.arg(viewer_id)
+        OR EXISTS (
+            SELECT 1 FROM follows
+            WHERE follows.followee_id = users.id
+                AND follows.follower_id = sqlc.arg(viewer_id)
+                AND follows.status = 'accepted'
+        )
+    )
+ORDER BY chirps.created_at ASC;
 
 -- name: GetChirp :one
 SELECT * FROM chirps
 WHERE id = $1;
 
+-- name: GetVisibleChirp :one
+SELECT sqlc.embed(chirps), users.handle, users.display_name, users.avatar_url, users.is_chirpy_red FROM chirps
+JOIN users ON chirps.user_id = users.id
+WHERE chirps.id = sqlc.arg(id)
+    AND (
+        users.is_protected = FALSE
+        OR users.id = sqlc.arg(viewer_id)
+        OR EXISTS (
+            SELECT 1 FROM follows
+            WHERE follows.followee_id = users.id
+                AND follows.follower_id = sqlc.arg(viewer_id)
+                AND follows.status = 'accepted'
+        )
+    );
+
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
+
+-- name: GetPublicChirpsSince :many
+SELECT chirps.* FROM chirps
+JOIN users ON chirps.user_id = users.id
+WHERE chirps.created_at > $1
+    AND users.is_protected = FALSE
+ORDER BY chirps.created_at DESC;
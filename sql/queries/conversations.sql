@@ -0,0 +1,56 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (id, created_at, updated_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW()
+)
+RETURNING *;
+
+-- name: AddConversationMember :exec
+INSERT INTO conversation_members (conversation_id, user_id, joined_at, last_read_at)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    NULL
+);
+
+-- name: GetConversationMember :one
+SELECT * FROM conversation_members
+WHERE conversation_id = $1 AND user_id = $2;
+
+-- name: GetConversationMembers :many
+SELECT * FROM conversation_members
+WHERE conversation_id = $1
+ORDER BY joined_at ASC;
+
+-- name: GetDirectConversation :one
+SELECT conversations.* FROM conversations
+JOIN conversation_members a ON conversations.id = a.conversation_id
+JOIN conversation_members b ON conversations.id = b.conversation_id
+WHERE a.user_id = $1
+    AND b.user_id = $2
+    AND (SELECT COUNT(*) FROM conversation_members m WHERE m.conversation_id = conversations.id) = 2
+LIMIT 1;
+
+-- name: GetConversationsForUser :many
+SELECT conversations.*, COUNT(messages.id) AS unread_count
+FROM conversations
+JOIN conversation_members ON conversations.id = conversation_members.conversation_id
+LEFT JOIN messages ON conversations.id = messages.conversation_id
+    AND messages.sender_id <> conversation_members.user_id
+    AND (conversation_members.last_read_at IS NULL OR messages.created_at > conversation_members.last_read_at)
+WHERE conversation_members.user_id = $1
+GROUP BY conversations.id
+ORDER BY conversations.updated_at DESC;
+
+-- name: TouchConversation :exec
+UPDATE conversations
+SET updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkConversationRead :exec
+UPDATE conversation_members
+SET last_read_at = NOW()
+WHERE conversation_id = $1 AND user_id = $2;
@@ -0,0 +1,45 @@
+-- name: DenyFamilyAccessTokens :many
+INSERT INTO denied_tokens (jti, expires_at, created_at)
+SELECT access_jti, access_expires_at, NOW() FROM refresh_tokens
+WHERE family_id = $1
+    AND access_jti IS NOT NULL
+    AND access_expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, CEIL(EXTRACT(EPOCH FROM expires_at - NOW()))::int AS ttl_seconds;
+
+-- name: DenyClientAccessTokens :many
+INSERT INTO denied_tokens (jti, expires_at, created_at)
+SELECT access_jti, access_expires_at, NOW() FROM refresh_tokens
+WHERE client_id = $1
+    AND access_jti IS NOT NULL
+    AND access_expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, CEIL(EXTRACT(EPOCH FROM expires_at - NOW()))::int AS ttl_seconds;
+
+-- name: DenyUserAccessTokens :many
+INSERT INTO denied_tokens (jti, expires_at, created_at)
+SELECT access_jti, access_expires_at, NOW() FROM refresh_tokens
+WHERE user_id = $1
+    AND access_jti IS NOT NULL
+    AND access_expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, CEIL(EXTRACT(EPOCH FROM expires_at - NOW()))::int AS ttl_seconds;
+
+-- name: DenyUserClientAccessTokens :many
+INSERT INTO denied_tokens (jti, expires_at, created_at)
+SELECT access_jti, access_expires_at, NOW() FROM refresh_tokens
+WHERE user_id = $1
+    AND client_id = $2
+    AND access_jti IS NOT NULL
+    AND access_expires_at > NOW()
+ON CONFLICT (jti) DO NOTHING
+RETURNING jti, CEIL(EXTRACT(EPOCH FROM expires_at - NOW()))::int AS ttl_seconds;
+
+-- name: GetDeniedTokens :many
+SELECT jti, CEIL(EXTRACT(EPOCH FROM expires_at - NOW()))::int AS ttl_seconds
+FROM denied_tokens
+WHERE expires_at > NOW();
+
+-- name: DeleteExpiredDeniedTokens :exec
+DELETE FROM denied_tokens
+WHERE expires_at <= NOW();
@@ -0,0 +1,29 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, user_id, email, created_at, expires_at, used_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    NOW() + INTERVAL '24 hours',
+    NULL
+);
+
+-- name: UseEmailVerificationToken :one
+UPDATE email_verification_tokens
+SET used_at = NOW()
+FROM users
+WHERE email_verification_tokens.token_hash = $1
+    AND email_verification_tokens.used_at IS NULL
+    AND email_verification_tokens.expires_at > NOW()
+    AND users.id = email_verification_tokens.user_id
+    AND LOWER(users.email) = LOWER(email_verification_tokens.email)
+RETURNING email_verification_tokens.user_id;
+
+-- name: DeleteEmailVerificationTokens :exec
+DELETE FROM email_verification_tokens
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: CountRecentEmailVerificationTokens :one
+SELECT COUNT(*) FROM email_verification_tokens
+WHERE user_id = $1 AND created_at > NOW() - INTERVAL '15 minutes';
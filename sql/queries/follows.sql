@@ -0,0 +1,36 @@
+-- name: CreateFollow :one
+INSERT INTO follows (follower_id, followee_id, status, created_at, updated_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    NOW()
+)
+ON CONFLICT (follower_id, followee_id) DO UPDATE
+SET updated_at = follows.updated_at
+RETURNING *;
+
+-- name: DeleteFollow :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: GetFollowRequests :many
+SELECT * FROM follows
+WHERE followee_id = $1 AND status = 'pending'
+ORDER BY created_at ASC;
+
+-- name: AcceptFollowRequest :one
+UPDATE follows
+SET status = 'accepted', updated_at = NOW()
+WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending'
+RETURNING *;
+
+-- name: AcceptAllFollowRequests :exec
+UPDATE follows
+SET status = 'accepted', updated_at = NOW()
+WHERE followee_id = $1 AND status = 'pending';
+
+-- name: DenyFollowRequest :execrows
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending';
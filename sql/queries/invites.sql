@@ -0,0 +1,42 @@
+-- name: CreateInvite :one
+INSERT INTO invites (id, code_hash, inviter_id, batch_id, max_uses, uses_remaining, expires_at, created_at)
+VALUES (
+    gen_random_uuid(),
+    sqlc.arg(code_hash),
+    sqlc.arg(inviter_id),
+    sqlc.narg(batch_id),
+    sqlc.arg(max_uses),
+    sqlc.arg(max_uses),
+    NOW() + sqlc.narg(expires_in_days)::int * INTERVAL '1 day',
+    NOW()
+)
+RETURNING *;
+
+-- name: CountUserInvites :one
+SELECT COUNT(*) FROM invites
+WHERE inviter_id = $1 AND batch_id IS NULL;
+
+-- name: GetUserInvites :many
+SELECT * FROM invites
+WHERE inviter_id = $1
+ORDER BY created_at DESC;
+
+-- name: RedeemInvite :one
+UPDATE invites
+SET uses_remaining = uses_remaining - 1
+WHERE code_hash = $1
+    AND uses_remaining > 0
+    AND (expires_at IS NULL OR expires_at > NOW())
+RETURNING id;
+
+-- name: CreateInviteRedemption :exec
+INSERT INTO invite_redemptions (invite_id, user_id, redeemed_at)
+VALUES ($1, $2, NOW());
+
+-- name: GetUserInviteRedemptions :many
+SELECT invite_redemptions.invite_id, invite_redemptions.user_id, users.handle, invite_redemptions.redeemed_at
+FROM invite_redemptions
+JOIN invites ON invites.id = invite_redemptions.invite_id
+JOIN users ON users.id = invite_redemptions.user_id
+WHERE invites.inviter_id = $1
+ORDER BY invite_redemptions.redeemed_at;
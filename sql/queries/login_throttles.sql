@@ -0,0 +1,56 @@
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (scope, subject, failures, last_failure_at, locked_until)
+VALUES (
+    $1,
+    $2,
+    1,
+    NOW(),
+    NULL
+)
+ON CONFLICT (scope, subject) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failure_at < NOW() - INTERVAL '24 hours' THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failure_at = NOW()
+RETURNING *;
+
+-- name: LockLoginThrottle :exec
+UPDATE login_throttles
+SET locked_until = NOW() + sqlc.arg(lock_seconds)::int * INTERVAL '1 second'
+WHERE scope = sqlc.arg(scope) AND subject = sqlc.arg(subject);
+
+-- name: GetLoginLockoutSeconds :one
+SELECT COALESCE(CEIL(EXTRACT(EPOCH FROM MAX(locked_until) - NOW())), 0)::int AS retry_after_seconds
+FROM login_throttles
+WHERE (
+        (scope = 'account' AND subject = sqlc.arg(email))
+        OR (scope = 'ip' AND subject = sqlc.arg(ip_address))
+    )
+    AND locked_until > NOW();
+
+-- name: ResetLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE scope = $1 AND subject = $2;
+
+-- name: GetActiveLockouts :many
+SELECT * FROM login_throttles
+WHERE locked_until > NOW()
+ORDER BY locked_until DESC;
+
+-- name: CreateLockoutEvent :exec
+INSERT INTO lockout_events (id, scope, subject, failures, ip_address, created_at, locked_until)
+VALUES (
+    gen_random_uuid(),
+    sqlc.arg(scope),
+    sqlc.arg(subject),
+    sqlc.arg(failures),
+    sqlc.arg(ip_address),
+    NOW(),
+    NOW() + sqlc.arg(lock_seconds)::int * INTERVAL '1 second'
+);
+
+-- name: GetLockoutEvents :many
+SELECT * FROM lockout_events
+ORDER BY created_at DESC
+LIMIT $1;
@@ -0,0 +1,48 @@
+-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (token_hash, user_id, nonce_hash, created_at, expires_at, used_at, email)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    NOW() + INTERVAL '15 minutes',
+    NULL,
+    $4
+);
+
+-- name: UseMagicLinkToken :one
+UPDATE magic_link_tokens
+SET used_at = NOW()
+FROM users
+WHERE magic_link_tokens.token_hash = $1
+    AND magic_link_tokens.nonce_hash = $2
+    AND magic_link_tokens.used_at IS NULL
+    AND magic_link_tokens.expires_at > NOW()
+    AND users.id = magic_link_tokens.user_id
+    AND LOWER(users.email) = LOWER(magic_link_tokens.email)
+RETURNING magic_link_tokens.user_id;
+
+-- name: DeleteMagicLinkTokens :exec
+DELETE FROM magic_link_tokens
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: LockMagicLinkRequests :exec
+SELECT pg_advisory_xact_lock(hashtext($1));
+
+-- name: CreateMagicLinkRequest :exec
+INSERT INTO magic_link_requests (email, created_at)
+VALUES ($1, NOW());
+
+-- name: GetMagicLinkRetrySeconds :one
+SELECT CASE
+        WHEN COUNT(*) >= sqlc.arg(max_requests)::int
+            THEN CEIL(EXTRACT(EPOCH FROM MIN(created_at) + INTERVAL '15 minutes' - NOW()))::int
+        ELSE 0
+    END AS retry_after_seconds
+FROM magic_link_requests
+WHERE email = sqlc.arg(email)
+    AND created_at > NOW() - INTERVAL '15 minutes';
+
+-- name: DeleteOldMagicLinkRequests :exec
+DELETE FROM magic_link_requests
+WHERE created_at <= NOW() - INTERVAL '15 minutes';
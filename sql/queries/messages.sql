@@ -0,0 +1,16 @@
+-- name: CreateMessage :one
+INSERT INTO messages (id, created_at, updated_at, body, conversation_id, sender_id)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: GetMessages :many
+SELECT * FROM messages
+WHERE conversation_id = $1
+ORDER BY created_at ASC;
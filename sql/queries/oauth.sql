@@ -0,0 +1,86 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, owner_id, name, redirect_uris, secret_hash, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: GetUserOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at DESC;
+
+-- name: SetOAuthClientResourceServer :one
+UPDATE oauth_clients
+SET is_resource_server = $1
+WHERE id = $2
+RETURNING *;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND owner_id = $2;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at, used_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW(),
+    NOW() + INTERVAL '10 minutes',
+    NULL
+);
+
+-- name: GetOAuthAuthorizationCodeForUpdate :one
+SELECT * FROM oauth_authorization_codes
+WHERE code_hash = $1
+FOR UPDATE;
+
+-- name: UseOAuthAuthorizationCode :exec
+UPDATE oauth_authorization_codes
+SET used_at = NOW(), family_id = $2
+WHERE code_hash = $1;
+
+-- name: DeleteUserClientAuthorizationCodes :exec
+DELETE FROM oauth_authorization_codes
+WHERE user_id = $1 AND client_id = $2;
+
+-- name: UpsertOAuthGrant :one
+INSERT INTO oauth_grants (user_id, client_id, scopes, created_at, updated_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    NOW()
+)
+ON CONFLICT (user_id, client_id) DO UPDATE
+SET scopes = EXCLUDED.scopes, updated_at = NOW()
+RETURNING *;
+
+-- name: GetOAuthGrant :one
+SELECT * FROM oauth_grants
+WHERE user_id = $1 AND client_id = $2;
+
+-- name: GetUserOAuthGrants :many
+SELECT oauth_grants.client_id, oauth_clients.name, oauth_grants.scopes, oauth_grants.created_at, oauth_grants.updated_at
+FROM oauth_grants
+JOIN oauth_clients ON oauth_clients.id = oauth_grants.client_id
+WHERE oauth_grants.user_id = $1
+ORDER BY oauth_grants.updated_at DESC;
+
+-- name: DeleteOAuthGrant :execrows
+DELETE FROM oauth_grants
+WHERE user_id = $1 AND client_id = $2;
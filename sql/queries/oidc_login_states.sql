@@ -0,0 +1,20 @@
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, user_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW(),
+    NOW() + INTERVAL '10 minutes'
+);
+
+-- name: UseOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1 AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+DELETE FROM oidc_login_states
+WHERE expires_at <= NOW();
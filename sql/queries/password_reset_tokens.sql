@@ -0,0 +1,42 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at, used_at)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    NOW() + INTERVAL '1 hour',
+    NULL
+);
+
+-- name: UsePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+    AND used_at IS NULL
+    AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: DeletePasswordResetTokens :exec
+DELETE FROM password_reset_tokens
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: LockPasswordResetRequests :exec
+SELECT pg_advisory_xact_lock(hashtext('password_reset:' || $1));
+
+-- name: CreatePasswordResetRequest :exec
+INSERT INTO password_reset_requests (email, created_at)
+VALUES ($1, NOW());
+
+-- name: GetPasswordResetRetrySeconds :one
+SELECT CASE
+        WHEN COUNT(*) >= sqlc.arg(max_requests)::int
+            THEN CEIL(EXTRACT(EPOCH FROM MIN(created_at) + INTERVAL '15 minutes' - NOW()))::int
+        ELSE 0
+    END AS retry_after_seconds
+FROM password_reset_requests
+WHERE email = sqlc.arg(email)
+    AND created_at > NOW() - INTERVAL '15 minutes';
+
+-- name: DeleteOldPasswordResetRequests :exec
+DELETE FROM password_reset_requests
+WHERE created_at <= NOW() - INTERVAL '15 minutes';
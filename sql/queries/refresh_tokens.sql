@@ -1,27 +1,79 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, expires_at, revoked_at, user_id)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id, user_agent, ip_address, last_used_at, access_jti, access_expires_at, client_id)
 VALUES (
-    $1,
+    sqlc.arg(token_hash),
     NOW(),
     NOW(),
     NOW() + INTERVAL '60 days',
     NULL,
-    $2
+    sqlc.arg(user_id),
+    sqlc.arg(family_id),
+    sqlc.arg(user_agent),
+    sqlc.arg(ip_address),
+    NOW(),
+    sqlc.arg(access_jti),
+    NOW() + sqlc.arg(access_ttl_seconds)::int * INTERVAL '1 second',
+    sqlc.arg(client_id)
 )
 RETURNING *;
 
 -- name: GetRefreshToken :one
 SELECT * FROM refresh_tokens
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: GetRefreshTokenForUpdate :one
+SELECT * FROM refresh_tokens
+WHERE token_hash = $1
+FOR UPDATE;
 
--- name: GetUserFromRefreshToken :one
-SELECT users.* FROM users 
-JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
-    AND refresh_tokens.expires_at > NOW()
-    AND refresh_tokens.revoked_at IS NULL;
+-- name: GetUserSessions :many
+SELECT
+    family_id,
+    user_agent,
+    ip_address,
+    (
+        SELECT MIN(family.created_at) FROM refresh_tokens family
+        WHERE family.family_id = refresh_tokens.family_id
+    )::timestamp AS started_at,
+    last_used_at,
+    expires_at
+FROM refresh_tokens
+WHERE user_id = $1
+    AND client_id IS NULL
+    AND rotated_at IS NULL
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+ORDER BY last_used_at DESC;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserClientRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND client_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET rotated_at = NOW(), last_used_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1
+    AND rotated_at IS NULL
+    AND revoked_at IS NULL
+    AND expires_at > NOW();
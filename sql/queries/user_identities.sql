@@ -0,0 +1,33 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (provider, subject, user_id, email, created_at, last_login_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW(),
+    NULL
+)
+RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = $1 AND subject = $2;
+
+-- name: GetUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET email = $1, last_login_at = NOW()
+WHERE provider = $2 AND subject = $3;
+
+-- name: CountUserIdentities :one
+SELECT COUNT(*) FROM user_identities
+WHERE user_id = $1;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identities
+WHERE user_id = $1 AND provider = $2;
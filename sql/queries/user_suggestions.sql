@@ -0,0 +1,62 @@
+-- name: GetFriendOfFriendCounts :many
+SELECT f1.follower_id AS user_id, f2.followee_id AS suggested_user_id, COUNT(*) AS mutual_count
+FROM follows f1
+JOIN follows f2 ON f1.followee_id = f2.follower_id
+WHERE f1.status = 'accepted'
+    AND f2.status = 'accepted'
+    AND f2.followee_id <> f1.follower_id
+GROUP BY f1.follower_id, f2.followee_id;
+
+-- name: GetRecentMentionCounts :many
+SELECT chirps.user_id AS author_id, mentioned.id AS mentioned_id, COUNT(*) AS mention_count
+FROM chirps
+JOIN users authors ON chirps.user_id = authors.id
+CROSS JOIN LATERAL regexp_matches(chirps.body, '(?:^|[^\w.])@(\w{3,15})\M', 'g') AS mention(groups)
+JOIN users mentioned ON LOWER(mentioned.handle) = LOWER(mention.groups[1])
+WHERE chirps.created_at > $1
+    AND authors.is_protected = FALSE
+    AND mentioned.id <> chirps.user_id
+GROUP BY chirps.user_id, mentioned.id;
+
+-- name: GetSuggestionExclusions :many
+SELECT follower_id AS user_id, followee_id AS excluded_user_id FROM follows
+UNION ALL
+SELECT blocker_id, blocked_id FROM blocks
+UNION ALL
+SELECT blocked_id, blocker_id FROM blocks
+UNION ALL
+SELECT muter_id, muted_id FROM mutes;
+
+-- name: DeleteUserSuggestions :exec
+DELETE FROM user_suggestions;
+
+-- name: CreateUserSuggestions :exec
+INSERT INTO user_suggestions (user_id, suggested_user_id, score, reason, created_at)
+SELECT user_id, suggested_user_id, score, reason, NOW()
+FROM unnest(
+    sqlc.arg(user_ids)::uuid[],
+    sqlc.arg(suggested_user_ids)::uuid[],
+    sqlc.arg(scores)::int[],
+    sqlc.arg(reasons)::text[]
+) AS s(user_id, suggested_user_id, score, reason);
+
+-- name: GetUserSuggestions :many
+SELECT * FROM user_suggestions
+WHERE user_id = $1
+    AND NOT EXISTS (
+        SELECT 1 FROM follows
+        WHERE follows.follower_id = user_suggestions.user_id
+            AND follows.followee_id = user_suggestions.suggested_user_id
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM blocks
+        WHERE (blocks.blocker_id = user_suggestions.user_id AND blocks.blocked_id = user_suggestions.suggested_user_id)
+            OR (blocks.blocker_id = user_suggestions.suggested_user_id AND blocks.blocked_id = user_suggestions.user_id)
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM mutes
+        WHERE mutes.muter_id = user_suggestions.user_id
+            AND mutes.muted_id = user_suggestions.suggested_user_id
+    )
+ORDER BY score DESC
+LIMIT $2;
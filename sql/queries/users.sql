@@ -14,16 +14,102 @@ DELETE FROM users;
 
 -- name: GetUser :one
 SELECT * FROM users
-WHERE email = $1;
+WHERE LOWER(email) = LOWER($1);
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUserByIDForUpdate :one
+SELECT * FROM users
+WHERE id = $1
+FOR UPDATE;
 
 -- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
+SET email = $1,
+    hashed_password = $2,
+    email_verified_at = CASE WHEN LOWER(email) = LOWER($1) THEN email_verified_at ELSE NULL END,
+    updated_at = NOW()
 WHERE id = $3
 RETURNING *;
 
+-- name: UpdateUserEmail :one
+UPDATE users
+SET email = $1,
+    email_verified_at = CASE WHEN LOWER(email) = LOWER($1) THEN email_verified_at ELSE NULL END,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
 -- name: UpgradeUserToChirpyRed :one
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1
 RETURNING *;
+
+-- name: SetUserProtected :one
+UPDATE users
+SET is_protected = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE LOWER(handle) = LOWER(sqlc.arg(handle)::text);
+
+-- name: UpdateUserHandle :one
+UPDATE users
+SET handle = $1, handle_updated_at = NOW(), updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET display_name = $1, bio = $2, avatar_url = $3, updated_at = NOW()
+WHERE id = $4
+RETURNING *;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2;
+
+-- name: SetUserTotpSecret :one
+UPDATE users
+SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: EnableUserTotp :one
+UPDATE users
+SET totp_enabled_at = NOW(), updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DisableUserTotp :one
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserTotpLastStep :execrows
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2 AND totp_last_step < $1;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: CountAdmins :one
+SELECT COUNT(*) FROM users
+WHERE role = 'admin';
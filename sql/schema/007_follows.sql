@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN is_protected BOOLEAN NOT NULL
+DEFAULT FALSE;
+
+CREATE TABLE follows(
+    follower_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (follower_id, followee_id)
+);
+
+-- +goose Down
+DROP TABLE follows;
+
+ALTER TABLE users
+DROP COLUMN is_protected;
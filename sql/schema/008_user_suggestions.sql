@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE user_suggestions(
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    suggested_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    score INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, suggested_user_id)
+);
+
+-- +goose Down
+DROP TABLE user_suggestions;
@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip_address TEXT NOT NULL DEFAULT '',
+ADD COLUMN last_used_at TIMESTAMP;
+
+UPDATE refresh_tokens SET last_used_at = updated_at;
+ALTER TABLE refresh_tokens ALTER COLUMN last_used_at SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN user_agent,
+DROP COLUMN ip_address,
+DROP COLUMN last_used_at;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- failed logins are counted per account (the email as typed, so unknown
+-- emails lock too) and per client IP
+CREATE TABLE login_throttles(
+    scope TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    PRIMARY KEY (scope, subject)
+);
+
+CREATE TABLE lockout_events(
+    id UUID PRIMARY KEY,
+    scope TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    ip_address TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NOT NULL
+);
+
+CREATE INDEX lockout_events_created_at_idx ON lockout_events(created_at);
+
+-- +goose Down
+DROP TABLE lockout_events;
+DROP TABLE login_throttles;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- the access token issued together with each refresh token, so revoking
+-- a session can also revoke its access tokens
+ALTER TABLE refresh_tokens
+ADD COLUMN access_jti TEXT,
+ADD COLUMN access_expires_at TIMESTAMP;
+
+CREATE TABLE denied_tokens(
+    jti TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX denied_tokens_expires_at_idx ON denied_tokens(expires_at);
+
+-- +goose Down
+DROP TABLE denied_tokens;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN access_jti,
+DROP COLUMN access_expires_at;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- actor and target have no foreign keys so events outlive the users they
+-- mention
+CREATE TABLE audit_events(
+    id UUID PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    actor_id UUID,
+    target_id UUID,
+    ip_address TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    details TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX audit_events_actor_id_idx ON audit_events(actor_id, created_at);
+CREATE INDEX audit_events_target_id_idx ON audit_events(target_id, created_at);
+CREATE INDEX audit_events_created_at_idx ON audit_events(created_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only();
@@ -0,0 +1,47 @@
+-- +goose Up
+CREATE TABLE oauth_clients(
+    id UUID PRIMARY KEY,
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    -- space-separated, matched exactly
+    redirect_uris TEXT NOT NULL,
+    -- NULL for public clients, which rely on PKCE alone
+    secret_hash TEXT,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX oauth_clients_owner_id_idx ON oauth_clients(owner_id);
+
+CREATE TABLE oauth_authorization_codes(
+    code_hash TEXT PRIMARY KEY,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+-- what each user has consented to; deleting the row revokes the app
+CREATE TABLE oauth_grants(
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    scopes TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, client_id)
+);
+
+-- refresh tokens issued to an app rather than a first-party login
+ALTER TABLE refresh_tokens
+ADD COLUMN client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN client_id;
+
+DROP TABLE oauth_grants;
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
@@ -0,0 +1,38 @@
+-- +goose Up
+-- accounts created through an identity provider have no password
+ALTER TABLE users
+ALTER COLUMN hashed_password DROP NOT NULL,
+ALTER COLUMN hashed_password DROP DEFAULT;
+
+CREATE TABLE user_identities(
+    provider TEXT NOT NULL,
+    -- the provider's stable "sub" claim; emails can change or be reused
+    subject TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_login_at TIMESTAMP,
+    PRIMARY KEY (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+-- sign-ins in progress, keyed by the hash of the state parameter
+CREATE TABLE oidc_login_states(
+    state_hash TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    -- set when an already logged in user is linking the provider
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oidc_login_states;
+DROP TABLE user_identities;
+
+UPDATE users SET hashed_password = 'unset' WHERE hashed_password IS NULL;
+ALTER TABLE users
+ALTER COLUMN hashed_password SET DEFAULT 'unset',
+ALTER COLUMN hashed_password SET NOT NULL;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE magic_link_tokens(
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- hash of the nonce cookie of the browser that asked for the link
+    nonce_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+-- every request, including ones for unknown emails, so the rate limit
+-- doesn't reveal which addresses are registered
+CREATE TABLE magic_link_requests(
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX magic_link_requests_email_created_at_idx ON magic_link_requests(email, created_at);
+
+-- +goose Down
+DROP TABLE magic_link_requests;
+DROP TABLE magic_link_tokens;
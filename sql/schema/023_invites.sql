@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE invites(
+    id UUID PRIMARY KEY,
+    code_hash TEXT UNIQUE NOT NULL,
+    inviter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- set on invites an admin minted in bulk, which don't count toward
+    -- the admin's own quota
+    batch_id UUID,
+    max_uses INTEGER NOT NULL,
+    uses_remaining INTEGER NOT NULL CHECK (uses_remaining >= 0),
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX invites_inviter_id_idx ON invites(inviter_id);
+
+CREATE TABLE invite_redemptions(
+    invite_id UUID NOT NULL REFERENCES invites(id) ON DELETE CASCADE,
+    user_id UUID UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redeemed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX invite_redemptions_invite_id_idx ON invite_redemptions(invite_id);
+
+-- +goose Down
+DROP TABLE invite_redemptions;
+DROP TABLE invites;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- emails used to be unique only as typed; accounts that differ just by
+-- case have to be resolved by hand, so list all of them and stop
+-- +goose StatementBegin
+DO $$
+DECLARE
+    collisions TEXT;
+BEGIN
+    SELECT string_agg(emails, '; ') INTO collisions
+    FROM (
+        SELECT string_agg(email || ' (' || id || ')', ', ' ORDER BY created_at) AS emails
+        FROM users
+        GROUP BY LOWER(email)
+        HAVING COUNT(*) > 1
+    ) AS duplicates;
+
+    IF collisions IS NOT NULL THEN
+        RAISE EXCEPTION 'users share an email apart from its case, resolve them before migrating: %', collisions;
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+
+CREATE UNIQUE INDEX users_email_lower_idx ON users (LOWER(email));
+
+-- +goose Down
+DROP INDEX IF EXISTS users_email_lower_idx;
+
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
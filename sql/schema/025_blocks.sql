@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE blocks(
+    blocker_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+
+CREATE INDEX blocks_blocked_id_idx ON blocks(blocked_id);
+
+-- +goose Down
+DROP TABLE blocks;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- a token only verifies the address it was sent to; outstanding tokens
+-- don't say which one that was, so they're dropped and can be resent
+DELETE FROM email_verification_tokens WHERE used_at IS NULL;
+
+ALTER TABLE email_verification_tokens
+ADD COLUMN email TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE email_verification_tokens
+ALTER COLUMN email DROP DEFAULT;
+
+CREATE INDEX email_verification_tokens_user_id_idx ON email_verification_tokens(user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS email_verification_tokens_user_id_idx;
+
+ALTER TABLE email_verification_tokens
+DROP COLUMN email;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- only clients an admin has marked as resource servers may introspect
+-- tokens issued to other clients
+ALTER TABLE oauth_clients
+ADD COLUMN is_resource_server BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE oauth_clients
+DROP COLUMN is_resource_server;
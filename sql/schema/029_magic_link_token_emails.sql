@@ -0,0 +1,14 @@
+-- +goose Up
+-- like verification tokens, a login link is tied to the address it was
+-- mailed to; outstanding links don't record it and are dropped
+DELETE FROM magic_link_tokens WHERE used_at IS NULL;
+
+ALTER TABLE magic_link_tokens
+ADD COLUMN email TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE magic_link_tokens
+ALTER COLUMN email DROP DEFAULT;
+
+-- +goose Down
+ALTER TABLE magic_link_tokens
+DROP COLUMN email;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- the session a code was exchanged for, so replaying the code can revoke it
+ALTER TABLE oauth_authorization_codes
+ADD COLUMN family_id UUID;
+
+-- +goose Down
+ALTER TABLE oauth_authorization_codes
+DROP COLUMN family_id;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- recent reset requests per email, counted by the forgot password limit
+CREATE TABLE password_reset_requests(
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX password_reset_requests_email_created_at_idx ON password_reset_requests(email, created_at);
+
+-- +goose Down
+DROP TABLE password_reset_requests;